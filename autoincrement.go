@@ -0,0 +1,111 @@
+package godbf
+
+import "encoding/binary"
+
+/*
+	VFP的自增字段说明：
+	文件类型是0x31，自增字段是整数字段，字段描述第19位的标志包含0x08，
+	第20-23位是下一个值，第24位是步长，每新增一条记录，下一个值加上步长并写回文件里的字段描述
+	dBase 7的自增字段类型是+，字段描述第41-44位是下一个值，步长固定为1
+*/
+
+func (f dbfField) isAutoincrement() bool {
+	return f.fieldType == fieldtype_autoincrement || f.flag & fieldflag_autoincrement != 0 && f.fieldType == fieldtype_integer
+}
+
+func (dbf *DBF)hasAutoincrement() bool {
+	for _, field := range dbf.fieldsList {
+		if field.isAutoincrement() {
+			return true
+		}
+	}
+	return false
+}
+
+// 字段描述里下一个值在文件里的位置
+func (dbf *DBF)autoincrementOffset(index int) int64 {
+	if dbf.isDBase7() {
+		return dbf.fieldDescriptorOffset(index) + 40
+	}
+	return dbf.fieldDescriptorOffset(index) + 19
+}
+
+// 重新读取自增字段的下一个值和步长，有可能其它进程已经新增过记录，调用方需要持有文件锁
+func (dbf *DBF)readAutoincrement() error {
+	buff := make([]byte, 5)
+	for i := range dbf.fieldsList {
+		if !dbf.fieldsList[i].isAutoincrement() {
+			continue
+		}
+		if _, err := dbf.reader.ReadAt(buff, dbf.autoincrementOffset(i)); err != nil {
+			return err
+		}
+		dbf.fieldsList[i].autoincrementNext = binary.LittleEndian.Uint32(buff[0:4])
+		if !dbf.isDBase7() {
+			dbf.fieldsList[i].autoincrementStep = buff[4]
+		}
+		dbf.fieldsMap[dbf.fieldsList[i].name] = dbf.fieldsList[i]
+	}
+	return nil
+}
+
+// 给当前记录的自增字段赋值，赋过的值会被覆盖，然后下一个值加上步长
+func (dbf *DBF)assignAutoincrement() {
+	for i := range dbf.fieldsList {
+		field := &dbf.fieldsList[i]
+		if !field.isAutoincrement() {
+			continue
+		}
+		dbf.encodeInt(fieldBytes(dbf.recordBuff, *field), int32(field.autoincrementNext))
+		dbf.setNullBit(*field, false)
+		field.autoincrementNext += uint32(field.autoincrementStep)
+		dbf.fieldsMap[field.name] = *field
+	}
+}
+
+// 把自增字段的下一个值写回文件里的字段描述，调用方需要持有文件锁
+func (dbf *DBF)writeAutoincrement() error {
+	buff := make([]byte, 4)
+	for i, field := range dbf.fieldsList {
+		if !field.isAutoincrement() {
+			continue
+		}
+		binary.LittleEndian.PutUint32(buff, field.autoincrementNext)
+		if _, err := dbf.file.WriteAt(buff, dbf.autoincrementOffset(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddAutoincrementField 添加自增的整数字段，seed是第一条记录的值，step是步长，文件会改成带自增字段的VFP格式(0x31)，
+// dBase 7文件添加的是+字段，步长只能是1。
+// 新增记录Post的时候在文件锁里自动赋值，自己赋的值会被覆盖，Post之后可以用IntValueByName取到分配的值
+func (dbf *DBF)AddAutoincrementField(fieldName string, seed uint32, step uint8) {
+	if dbf.isDBase7() {
+		if dbf.addField(fieldName, fieldtype_autoincrement, 4, 0) == nil {
+			dbf.setAutoincrement(fieldName, seed, 1)
+		}
+		return
+	}
+	if dbf.addField(fieldName, fieldtype_integer, 4, 0) != nil {
+		return
+	}
+	dbf.useVisualFoxPro()
+	dbf.head.fileType = byte(foxProAutoincrement)
+	dbf.setAutoincrement(fieldName, seed, step)
+}
+
+func (dbf *DBF)setAutoincrement(fieldName string, seed uint32, step uint8) {
+	for i := range dbf.fieldsList {
+		field := &dbf.fieldsList[i]
+		if field.name == fieldName {
+			if field.fieldType == fieldtype_integer {
+				field.flag |= fieldflag_autoincrement
+			}
+			field.autoincrementNext = seed
+			field.autoincrementStep = step
+			dbf.fieldsMap[fieldName] = *field
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package godbf
+
+import (
+	"bufio"
+	"io"
+)
+
+// BeginBatch 开始批量新增，到Commit之前一直持有文件锁，
+// 期间Append之后Post的记录连续写到缓冲区，不再每条记录都重新读取和改写文件头，Commit的时候一次性更新记录数和修改日期。
+// 批量新增期间不能修改已有的记录，读取记录时能读到还没有Commit的新记录
+//
+//	if err := dbf.BeginBatch(); err != nil {
+//		return err
+//	}
+//	for _, q := range quotes {
+//		dbf.Append()
+//		dbf.SetFieldValue("STOCK_CODE", q.Code)
+//		if err := dbf.Post(); err != nil {
+//			dbf.Rollback()
+//			return err
+//		}
+//	}
+//	return dbf.Commit()
+func (dbf *DBF)BeginBatch() (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.batch != nil {
+		return batch_in_progress
+	}
+	if dbf.fieldsCount <= 0 {
+		return empty_fields
+	}
+	if dbf.file == nil {
+		if err = dbf.SaveNewFile(); err != nil {
+			return err
+		}
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	// 加锁之后重新读取文件头，有可能有其它进程已经写了新数据进来
+	if err = dbf.readHead(); err != nil {
+		dbf.unlock()
+		return err
+	}
+	if err = dbf.readAutoincrement(); err != nil {
+		dbf.unlock()
+		return err
+	}
+	dbf.batchStart = dbf.head.recordCount
+	size := int(dbf.head.recordSize)
+	dbf.batch = bufio.NewWriterSize(io.NewOffsetWriter(dbf.file, dbf.recordOffset(dbf.head.recordCount + 1)), 64 * size)
+	return nil
+}
+
+// 批量新增时提交一条记录，调用方已经持有文件锁
+func (dbf *DBF)postBatch() error {
+	if !dbf.append {
+		return batch_in_progress
+	}
+	if err := dbf.flushMemo(); err != nil {
+		return err
+	}
+	dbf.assignAutoincrement()
+	if _, err := dbf.batch.Write(dbf.recordBuff); err != nil {
+		return err
+	}
+	dbf.head.recordCount += 1
+	return nil
+}
+
+// Commit 把缓冲区的记录写到文件，更新文件头的记录数和修改日期，然后释放文件锁
+func (dbf *DBF)Commit() (err error) {
+	if dbf.batch == nil {
+		return no_batch_in_progress
+	}
+	defer dbf.endBatch()
+	if err = dbf.batch.Flush(); err != nil {
+		return err
+	}
+	if _, err = dbf.file.WriteAt([]byte{fileTerminator}, dbf.recordOffset(dbf.head.recordCount + 1)); err != nil {
+		return err
+	}
+	if err = dbf.writeAutoincrement(); err != nil {
+		return err
+	}
+	return dbf.writeHeadUpdate(dbf.now())
+}
+
+// Rollback 放弃BeginBatch之后新增的记录，然后释放文件锁。已经写到备注文件的内容不会回收
+func (dbf *DBF)Rollback() (err error) {
+	if dbf.batch == nil {
+		return no_batch_in_progress
+	}
+	defer dbf.endBatch()
+	dbf.head.recordCount = dbf.batchStart
+	// 缓冲区满的时候可能已经有部分记录写到文件里了，截断掉
+	end := dbf.recordOffset(dbf.head.recordCount + 1)
+	if err = dbf.file.Truncate(end); err != nil {
+		return err
+	}
+	if _, err = dbf.file.WriteAt([]byte{fileTerminator}, end); err != nil {
+		return err
+	}
+	// 自增字段的下一个值还原成文件里的值
+	return dbf.readAutoincrement()
+}
+
+func (dbf *DBF)endBatch() {
+	dbf.batch = nil
+	dbf.append = false
+	dbf.unlock()
+}
+
+// 记录在文件里的位置，recordNo从1开始
+func (dbf *DBF)recordOffset(recordNo uint32) int64 {
+	return int64(dbf.head.dataOffset) + int64(recordNo - 1) * int64(dbf.head.recordSize)
+}
@@ -0,0 +1,170 @@
+package godbf
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+/*
+	打开文件时检查文件结构：
+	字段描述必须以0x0D结束，字段长度加上删除标记要等于记录长度，VFP字段描述里的位置要和按顺序累加的位置一致（其它格式不一致时只记警告），
+	文件长度要放得下文件头记录数那么多的记录。
+	默认发现问题直接返回CorruptError，Lenient()模式下尽量恢复，问题记在Warnings()里
+*/
+
+// CorruptError 文件结构有问题，Err是ErrBadTerminator之类的错误，可以用errors.Is判断
+type CorruptError struct {
+	Err error
+	Detail string
+}
+
+func (e *CorruptError) Error() string {
+	return "corrupt dbf file: " + e.Err.Error() + " (" + e.Detail + ")"
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// Warnings 打开文件时发现并且已经恢复的问题，都是*CorruptError。
+// Lenient()模式下记录所有恢复的问题；默认模式下只有非VFP文件字段描述里的位置不一致，不影响读取，也记在这里
+func (dbf *DBF)Warnings() []error {
+	return dbf.warnings
+}
+
+// 发现结构问题，默认返回错误，宽松模式下记为警告，返回nil表示可以继续
+func (dbf *DBF)corrupt(err error, detail string) error {
+	if !dbf.lenient {
+		return &CorruptError{Err: err, Detail: detail}
+	}
+	dbf.warn(err, detail)
+	return nil
+}
+
+// 记一个警告
+func (dbf *DBF)warn(err error, detail string) {
+	dbf.warnings = append(dbf.warnings, &CorruptError{Err: err, Detail: detail})
+}
+
+// 从第一个字段描述开始扫描到0x0D结束符，不超过数据开始的位置
+func (dbf *DBF)scanFieldDescriptors() ([][]byte, error) {
+	size := int64(32)
+	if dbf.isDBase7() {
+		size = dbase7FieldSize
+	}
+	var descriptors [][]byte
+	for offset := dbf.fieldDescriptorOffset(0); offset < int64(dbf.head.dataOffset); offset += size {
+		buff := make([]byte, size)
+		n, err := dbf.reader.ReadAt(buff, offset)
+		if n > 0 && buff[0] == headerTerminator {
+			return descriptors, nil
+		}
+		if int64(n) < size {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			return descriptors, dbf.corrupt(ErrTruncatedHeader, "field descriptor at " + strconv.FormatInt(offset, 10) + " is cut off")
+		}
+		descriptors = append(descriptors, buff)
+	}
+	return descriptors, dbf.corrupt(ErrBadTerminator, "no 0x0D before data offset " + strconv.Itoa(int(dbf.head.dataOffset)))
+}
+
+// 按字段顺序累加计算每个字段的位置
+func (dbf *DBF)layoutReadFields(fields []dbfField) error {
+	// 第1位是删除标记
+	var displacement uint32 = 1
+	for i := range fields {
+		f := &fields[i]
+		if f.displacement != displacement {
+			detail := "field " + f.name + " offset " + strconv.FormatUint(uint64(f.displacement), 10) + ", expected " + strconv.FormatUint(uint64(displacement), 10)
+			if dbf.isVisualFoxPro() {
+				if err := dbf.corrupt(ErrInconsistentRecordSize, detail); err != nil {
+					return err
+				}
+			} else if f.displacement != 0 {
+				// 其它格式有的程序在这里写的是内存地址，只记警告，按顺序计算的位置读取
+				dbf.warn(ErrInconsistentRecordSize, detail)
+			}
+		}
+		f.displacement = displacement
+		displacement += uint32(f.length)
+	}
+	return nil
+}
+
+// 检查字段长度加上删除标记是否等于记录长度。宽松模式下，如果按字段长度算出来的记录长度和文件长度吻合，就用算出来的记录长度，
+// 否则还是按文件头的记录长度读取，去掉放不下的字段
+func (dbf *DBF)checkRecordSize(size int64) error {
+	recordSize := uint32(1)
+	if n := len(dbf.fieldsList); n > 0 {
+		last := dbf.fieldsList[n - 1]
+		recordSize = last.displacement + uint32(last.length)
+	}
+	if recordSize == uint32(dbf.head.recordSize) {
+		return nil
+	}
+	if err := dbf.corrupt(ErrInconsistentRecordSize, "fields take " + strconv.FormatUint(uint64(recordSize), 10) + " bytes, record size is " + strconv.Itoa(int(dbf.head.recordSize))); err != nil {
+		return err
+	}
+	data := size - int64(dbf.head.dataOffset)
+	expected := int64(dbf.head.recordCount) * int64(recordSize)
+	if recordSize <= math.MaxUint16 && (data == expected || data == expected + 1) {
+		dbf.head.recordSize = uint16(recordSize)
+		dbf.recover()
+		return nil
+	}
+	for i, f := range dbf.fieldsList {
+		if f.displacement + uint32(f.length) > uint32(dbf.head.recordSize) {
+			for _, dropped := range dbf.fieldsList[i:] {
+				delete(dbf.fieldsMap, dropped.name)
+				delete(dbf.foldedNames, foldFieldName(dropped.name))
+			}
+			dbf.fieldsList = dbf.fieldsList[:i]
+			dbf.fieldsCount = len(dbf.fieldsList)
+			dbf.assignNullBits()
+			break
+		}
+	}
+	return nil
+}
+
+// 记下恢复出来的记录长度和记录数，之后重新读取文件头时仍然使用，所以宽松模式下恢复过的文件看不到其它进程之后追加的记录
+func (dbf *DBF)recover() {
+	head := dbf.head
+	dbf.recovered = &head
+}
+
+// 检查文件长度是否放得下文件头里的记录数，宽松模式下记录数改成完整的记录条数
+func (dbf *DBF)checkFileSize(size int64) error {
+	if size < int64(dbf.head.dataOffset) {
+		if err := dbf.corrupt(ErrTruncatedHeader, "file size " + strconv.FormatInt(size, 10) + ", data offset " + strconv.Itoa(int(dbf.head.dataOffset))); err != nil {
+			return err
+		}
+		dbf.head.recordCount = 0
+		dbf.recover()
+		return nil
+	}
+	if dbf.head.recordSize == 0 {
+		return nil
+	}
+	data := size - int64(dbf.head.dataOffset)
+	complete := data / int64(dbf.head.recordSize)
+	if complete >= int64(dbf.head.recordCount) {
+		// 比记录数长的部分是文件结束符，或者是其它进程正在追加还没有更新文件头的记录
+		return nil
+	}
+	var err error
+	if data % int64(dbf.head.recordSize) != 0 && complete == int64(dbf.head.recordCount) - 1 {
+		err = dbf.corrupt(ErrTruncatedRecord, "record " + strconv.FormatInt(complete + 1, 10) + " has " + strconv.FormatInt(data % int64(dbf.head.recordSize), 10) + " of " + strconv.Itoa(int(dbf.head.recordSize)) + " bytes")
+	} else {
+		err = dbf.corrupt(ErrRecordCountMismatch, "header has " + strconv.FormatUint(uint64(dbf.head.recordCount), 10) + " records, file has " + strconv.FormatInt(complete, 10))
+	}
+	if err != nil {
+		return err
+	}
+	dbf.head.recordCount = uint32(complete)
+	dbf.recover()
+	return nil
+}
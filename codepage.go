@@ -0,0 +1,232 @@
+package godbf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 语言驱动ID(LDID，文件头第30位)和代码页的对应关系
+var codePages = map[byte]int{
+	0x01: 437,  // US MS-DOS
+	0x02: 850,  // International MS-DOS
+	0x03: 1252,  // Windows ANSI
+	0x04: 10000,  // Standard Macintosh
+	0x08: 865,  // Danish OEM
+	0x09: 437,  // Dutch OEM
+	0x0A: 850,  // Dutch OEM*
+	0x0B: 437,  // Finnish OEM
+	0x0D: 437,  // French OEM
+	0x0E: 850,  // French OEM*
+	0x0F: 437,  // German OEM
+	0x10: 850,  // German OEM*
+	0x11: 437,  // Italian OEM
+	0x12: 850,  // Italian OEM*
+	0x13: 932,  // Japanese Shift-JIS
+	0x14: 850,  // Spanish OEM*
+	0x15: 437,  // Swedish OEM
+	0x16: 850,  // Swedish OEM*
+	0x17: 865,  // Norwegian OEM
+	0x18: 437,  // Spanish OEM
+	0x19: 437,  // English OEM (Britain)
+	0x1A: 850,  // English OEM (Britain)*
+	0x1B: 437,  // English OEM (US)
+	0x1C: 863,  // French OEM (Canada)
+	0x1D: 850,  // French OEM*
+	0x1F: 852,  // Czech OEM
+	0x22: 852,  // Hungarian OEM
+	0x23: 852,  // Polish OEM
+	0x24: 860,  // Portuguese OEM
+	0x25: 850,  // Portuguese OEM*
+	0x26: 866,  // Russian OEM
+	0x37: 850,  // English OEM (US)*
+	0x40: 852,  // Romanian OEM
+	0x4D: 936,  // Chinese GBK (PRC)
+	0x4E: 949,  // Korean (ANSI/OEM)
+	0x4F: 950,  // Chinese Big5 (Taiwan)
+	0x50: 874,  // Thai (ANSI/OEM)
+	0x57: 1252,  // ANSI
+	0x58: 1252,  // Western European ANSI
+	0x59: 1252,  // Spanish ANSI
+	0x64: 852,  // Eastern European MS-DOS
+	0x65: 866,  // Russian MS-DOS
+	0x66: 865,  // Nordic MS-DOS
+	0x67: 861,  // Icelandic MS-DOS
+	0x6A: 737,  // Greek MS-DOS (437G)
+	0x6B: 857,  // Turkish MS-DOS
+	0x6C: 863,  // French-Canadian MS-DOS
+	0x78: 950,  // Taiwan Big 5
+	0x79: 949,  // Hangul (Wansung)
+	0x7A: 936,  // PRC GBK
+	0x7B: 932,  // Japanese Shift-JIS
+	0x7C: 874,  // Thai Windows/MS-DOS
+	0x7D: 1255,  // Hebrew Windows
+	0x7E: 1256,  // Arabic Windows
+	0x86: 737,  // Greek OEM
+	0x87: 852,  // Slovenian OEM
+	0x88: 857,  // Turkish OEM
+	0x96: 10007,  // Russian Macintosh
+	0x97: 10029,  // Eastern European Macintosh
+	0x98: 10006,  // Greek Macintosh
+	0xC8: 1250,  // Eastern European Windows
+	0xC9: 1251,  // Russian Windows
+	0xCA: 1254,  // Turkish Windows
+	0xCB: 1253,  // Greek Windows
+	0xCC: 1257,  // Baltic Windows
+}
+
+// 代码页对应的编码名称
+var codePageEncodings = map[int]string{
+	437: "IBM437",
+	850: "IBM850",
+	852: "IBM852",
+	860: "IBM860",
+	863: "IBM863",
+	865: "IBM865",
+	866: "IBM866",
+	874: "windows-874",
+	932: "Shift_JIS",
+	936: "GBK",
+	949: "EUC-KR",
+	950: "Big5",
+	1250: "windows-1250",
+	1251: "windows-1251",
+	1252: "windows-1252",
+	1253: "windows-1253",
+	1254: "windows-1254",
+	1255: "windows-1255",
+	1256: "windows-1256",
+	1257: "windows-1257",
+	10000: "macintosh",
+	10007: "x-mac-cyrillic",
+}
+
+// 新建文件时每个代码页写入的语言驱动ID，同一个代码页有多个ID时取Windows/VFP常用的那个
+var codePageLanguageDrivers = map[int]byte{
+	437: 0x01,
+	850: 0x02,
+	852: 0x64,
+	860: 0x24,
+	863: 0x6C,
+	865: 0x66,
+	866: 0x65,
+	874: 0x7C,
+	932: 0x7B,
+	936: 0x7A,
+	949: 0x79,
+	950: 0x78,
+	1250: 0xC8,
+	1251: 0xC9,
+	1252: 0x03,
+	1253: 0xCB,
+	1254: 0xCA,
+	1255: 0x7D,
+	1256: 0x7E,
+	1257: 0xCC,
+	10000: 0x04,
+	10007: 0x96,
+}
+
+// 编码名称的别名对应的代码页，名称比较时忽略大小写、-和_
+var encodingCodePages = map[string]int{
+	"gbk": 936, "gb2312": 936, "gb18030": 936, "cp936": 936, "936": 936,
+	"big5": 950, "cp950": 950, "950": 950,
+	"shiftjis": 932, "sjis": 932, "cp932": 932, "932": 932,
+	"euckr": 949, "cp949": 949, "949": 949,
+}
+
+func init() {
+	for cp, name := range codePageEncodings {
+		encodingCodePages[normalizeEncodingName(name)] = cp
+		encodingCodePages["cp" + strconv.Itoa(cp)] = cp
+		encodingCodePages[strconv.Itoa(cp)] = cp
+	}
+}
+
+func normalizeEncodingName(name string) string {
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// 编码名称对应的语言驱动ID，不认识的编码（比如utf8）返回0
+func languageDriverOf(encoding string) byte {
+	return codePageLanguageDrivers[encodingCodePages[normalizeEncodingName(encoding)]]
+}
+
+// 按语言驱动ID推断编码，没有设置或者不认识时返回空；
+// 认识但是不支持的代码页（比如希腊语737、土耳其语857）返回ErrUnknownEncoding，不能按默认编码读成乱码
+func encodingOfLanguageDriver(ldid byte) (string, error) {
+	cp, ok := codePages[ldid]
+	if !ok {
+		return "", nil
+	}
+	return encodingOfCodePage(cp, fmt.Sprintf("language driver %#x", ldid))
+}
+
+// 代码页对应的编码，不支持时返回ErrUnknownEncoding
+func encodingOfCodePage(cp int, source string) (string, error) {
+	if encoding, ok := codePageEncodings[cp]; ok {
+		return encoding, nil
+	}
+	return "", fmt.Errorf("%w: code page %d of %s", ErrUnknownEncoding, cp, source)
+}
+
+// dBase 7写入的语言驱动名称，其余的按名称里的代码页推断
+var codePageLanguageDriverNames = map[int]string{
+	437: "DB437US0",
+	850: "DB850US0",
+	866: "DB866RU0",
+	1252: "DBWINUS0",
+}
+
+// 编码名称对应的dBase 7语言驱动名称，不认识的编码返回空
+func languageDriverNameOf(encoding string) string {
+	return codePageLanguageDriverNames[encodingCodePages[normalizeEncodingName(encoding)]]
+}
+
+// 按dBase 7的语言驱动名称推断编码，DBWIN开头的是ANSI(1252)，DB后面跟代码页的比如DB437US0、DB866RU0，
+// 不认识时返回空，代码页不支持时返回ErrUnknownEncoding
+func encodingOfLanguageDriverName(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if strings.HasPrefix(name, "DBWIN") {
+		return codePageEncodings[1252], nil
+	}
+	if !strings.HasPrefix(name, "DB") {
+		return "", nil
+	}
+	digits := name[2:]
+	if i := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		digits = digits[:i]
+	}
+	cp, _ := strconv.Atoi(digits)
+	if cp == 0 {
+		return "", nil
+	}
+	return encodingOfCodePage(cp, "language driver " + name)
+}
+
+// 读取和DBF同名的.cpg文件里的编码，shapefile的工具都会写这个文件，内容是编码名称或者代码页，比如UTF-8、GBK、1252、ANSI 1252
+func encodingOfCPG(filename string) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	var data []byte
+	var err error
+	for _, cpg := range []string{".cpg", ".CPG"} {
+		if data, err = os.ReadFile(base + cpg); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return ""
+	}
+	text := strings.TrimSpace(string(data))
+	text = strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(text), "ANSI"))
+	if cp, err := strconv.Atoi(text); err == nil {
+		if text == "88591" {
+			return "ISO-8859-1"
+		}
+		return codePageEncodings[cp]
+	}
+	return text
+}
@@ -0,0 +1,207 @@
+package godbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+)
+
+/*
+	dBase 7文件结构说明：
+	文件头 32位长度，第1位是0x04(没有备注)或者0x8C(有备注，.DBT备注文件和dBase IV一样)
+	语言驱动名称 32位长度，比如DBWINUS0，之后4位保留
+	字段属性说明 每个字段48位长度：
+		第1-32位字段名，第33位字段类型，第34位字段长度，第35位小数位数，第41-44位自增字段的下一个值
+		字段描述里没有字段在记录里的位置，按字段顺序累加长度计算
+	文件头结束符 1位长度
+	I/+ 字段按大端存储并翻转符号位，O字段是大端的双精度浮点数，正数翻转符号位，负数所有位取反，这样可以直接按字节排序，全0表示空值
+	@ 字段是大端的双精度浮点数，值是从0001-01-01开始(这一天是第1天)的毫秒数
+*/
+
+const dbase7FieldSize = 48
+const dbase7FieldsOffset = 68  //32位文件头 + 32位语言驱动名称 + 4位保留
+const dbase7FieldNameSize = 32
+
+// 0001-01-01是第1天，1970-01-01是第719163天
+const dbase7DaysOfUnixEpoch = 719163
+const millisecondsPerDay = 86400000
+
+func (dbf *DBF)isDBase7() bool {
+	t := fileType(dbf.head.fileType)
+	return t == dbase7 || t == dbase7_Memo
+}
+
+// dBase 7字段类型只能用在dBase 7文件里，新文件里出现dBase 7字段时把文件类型改成dBase 7
+func (dbf *DBF)useDBase7() {
+	if dbf.isDBase7() {
+		return
+	}
+	if dbf.isVisualFoxPro() {
+		if dbf.fieldErr == nil {
+			dbf.fieldErr = unsupported_field_type
+		}
+		return
+	}
+	dbf.head.fileType = byte(dbase7)
+	if dbf.hasMemo() {
+		dbf.head.fileType = byte(dbase7_Memo)
+	}
+	dbf.layoutFields()
+}
+
+// 检查字段类型能不能用在当前的文件格式里，VFP和dBase 7各自的字段类型不能混用
+func (dbf *DBF)checkFieldType(f Field) error {
+	switch fieldType(f.Type) {
+	case fieldtype_timestamp, fieldtype_autoincrement, fieldtype_double7:
+		if dbf.isVisualFoxPro() || f.Nullable || f.Binary {
+			return unsupported_field_type
+		}
+	case fieldtype_double, fieldtype_currency, fieldtype_dateTime, fieldtype_varchar, fieldtype_varbinary, fieldtype_blob:
+		if dbf.isDBase7() {
+			return unsupported_field_type
+		}
+	}
+	if dbf.isDBase7() && (f.Nullable || f.Binary) {
+		return unsupported_field_type
+	}
+	return nil
+}
+
+// 字段描述在文件里的位置
+func (dbf *DBF)fieldDescriptorOffset(index int) int64 {
+	if dbf.isDBase7() {
+		return int64(dbase7FieldsOffset + index * dbase7FieldSize)
+	}
+	return int64(32 + index * 32)
+}
+
+// dBase 7文件头之后的语言驱动名称
+func (dbf *DBF)readLanguageDriverName() error {
+	buff := make([]byte, dbase7FieldNameSize)
+	if _, err := dbf.reader.ReadAt(buff, 32); err != nil {
+		return err
+	}
+	dbf.languageDriverName = strings.TrimSpace(string(bytes.TrimRight(buff, "\x00")))
+	return nil
+}
+
+// LanguageDriverName dBase 7文件头里的语言驱动名称，比如DBWINUS0，其它格式的文件返回空
+func (dbf *DBF)LanguageDriverName() string {
+	return dbf.languageDriverName
+}
+
+// 解析48位的字段描述，字段的位置在layoutReadFields里按顺序计算
+func (dbf *DBF)newField7(fieldBuff []byte) dbfField {
+	field := dbfField{
+		name:              strings.TrimSpace(dbf.decodeName(bytes.TrimRight(fieldBuff[:dbase7FieldNameSize], "\x00"))),
+		fieldType:         fieldType(fieldBuff[32]),
+		length:            fieldBuff[33],
+		decimalPlaces:     fieldBuff[34],
+		autoincrementNext: binary.LittleEndian.Uint32(fieldBuff[40:44]),
+		reserved:          fieldBuff[35:48],
+	}
+	if field.fieldType == fieldtype_autoincrement {
+		field.autoincrementStep = 1
+	}
+	return field
+}
+
+// dBase 7的语言驱动名称和48位的字段描述，写到文件头buff里
+func (dbf *DBF)putFields7(buff []byte) {
+	name := dbf.languageDriverName
+	if name == "" {
+		name = languageDriverNameOf(dbf.encoding)
+	}
+	copy(buff[32: 32 + dbase7FieldNameSize], name)
+	for i, field := range dbf.fieldsList {
+		b := buff[dbf.fieldDescriptorOffset(i):][:dbase7FieldSize]
+		copy(b[:dbase7FieldNameSize - 1], str2bytes(field.name))
+		b[32] = byte(field.fieldType)
+		b[33] = field.length
+		b[34] = field.decimalPlaces
+		if field.isAutoincrement() {
+			binary.LittleEndian.PutUint32(b[40:44], field.autoincrementNext)
+		}
+	}
+	buff[dbf.fieldDescriptorOffset(dbf.fieldsCount)] = headerTerminator
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 整数字段的值，VFP是小端整数，dBase 7是翻转了符号位的大端整数，全0是空值
+func (dbf *DBF)decodeInt(b []byte) int32 {
+	if !dbf.isDBase7() {
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+	if isZero(b) {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b) ^ 0x80000000)
+}
+
+func (dbf *DBF)encodeInt(b []byte, v int32) {
+	if !dbf.isDBase7() {
+		binary.LittleEndian.PutUint32(b, uint32(v))
+		return
+	}
+	binary.BigEndian.PutUint32(b, uint32(v) ^ 0x80000000)
+}
+
+func decodeDouble7(b []byte) float64 {
+	u := binary.BigEndian.Uint64(b)
+	if u == 0 {
+		return 0
+	}
+	if u & (1 << 63) != 0 {
+		u ^= 1 << 63
+	} else {
+		u = ^u
+	}
+	return math.Float64frombits(u)
+}
+
+func encodeDouble7(b []byte, v float64) {
+	u := math.Float64bits(v)
+	if u & (1 << 63) == 0 {
+		u ^= 1 << 63
+	} else {
+		u = ^u
+	}
+	binary.BigEndian.PutUint64(b, u)
+}
+
+func decodeTimestamp(b []byte) time.Time {
+	u := binary.BigEndian.Uint64(b)
+	if u == 0 {
+		return time.Time{}
+	}
+	ms := int64(math.Float64frombits(u))
+	days := ms / millisecondsPerDay
+	ms -= days * millisecondsPerDay
+	return time.Date(1970, 1, 1 + int(days - dbase7DaysOfUnixEpoch), 0, 0, 0, int(ms) * int(time.Millisecond), time.Local)
+}
+
+func encodeTimestamp(b []byte, t time.Time) {
+	if t.IsZero() {
+		copy(b, make([]byte, len(b)))
+		return
+	}
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400 + dbase7DaysOfUnixEpoch
+	ms := ((t.Hour() * 60 + t.Minute()) * 60 + t.Second()) * 1000 + t.Nanosecond() / int(time.Millisecond)
+	binary.BigEndian.PutUint64(b, math.Float64bits(float64(days * millisecondsPerDay + int64(ms))))
+}
+
+// AddTimestampField 添加dBase 7的日期时间字段，文件会改成dBase 7格式
+func (dbf *DBF)AddTimestampField(fieldName string) {
+	dbf.useDBase7()
+	dbf.addField(fieldName, fieldtype_timestamp, 8, 0)
+}
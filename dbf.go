@@ -1,10 +1,11 @@
 package godbf
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
-	"github.com/axgle/mahonia"
 	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding"
 	"io"
 	"os"
 	"strconv"
@@ -15,7 +16,8 @@ import (
 type DBF struct {
 	head dbfHeader
 	headBuff []byte
-	file *os.File
+	file *os.File  //只读模式或者NewReader时为nil
+	reader io.ReaderAt  //读取数据用，打开文件时就是file
 	filename string
 	currentRecordNo uint32
 	fieldsMap map[string]dbfField
@@ -23,47 +25,181 @@ type DBF struct {
 	fieldsCount int
 	recordBuff []byte
 	eof bool
-	encoder mahonia.Encoder
-	decoder mahonia.Decoder
+	encoder *encoding.Encoder
+	decoder *encoding.Decoder
 	append bool
 	filelock tryLockerSafe
-}
-
-func LoadFrom(filename string, encoding string) (dbf *DBF, err error) {
-	f, err := os.OpenFile(filename, os.O_RDWR, 0666)
+	lockDepth int  //文件锁的嵌套层数，Locked里的写操作不再单独加锁
+	memo *memoFile
+	memoBuff map[string][]byte  //待写入备注文件的内容，Post的时候写入
+	overflow OverflowPolicy
+	encoding string  //编码名称
+	textEncoding encoding.Encoding
+	strictEncoding bool
+	readOnly bool
+	batch *bufio.Writer  //BeginBatch之后新增记录的缓冲区
+	batchStart uint32  //BeginBatch时的记录数，Rollback用
+	clock func() time.Time
+	foldedNames map[string]string  //大写的字段名到实际字段名，不区分大小写查找字段用
+	caseSensitive bool  //字段名区分大小写
+	fieldErr error  //添加字段时的第一个错误，SaveNewFile的时候返回
+	nullFlags *dbfField  //VFP的_NullFlags字段，没有时为nil
+	showSystemFields bool  //FieldNames和Fields里包括_NullFlags之类的系统字段
+	languageDriverName string  //dBase 7的语言驱动名称
+	recordCountHint *uint32  //WithRecordCount声明的记录数，Writer用
+	useCPG bool  //推断编码时先看同名的.cpg文件
+	lenient bool  //打开文件时尽量恢复结构问题，见Lenient
+	warnings []error  //宽松模式下打开文件时发现的问题
+	recovered *dbfHeader  //宽松模式下恢复出来的文件头
+}
+
+func LoadFrom(filename string, encoding string, opts ...Option) (dbf *DBF, err error) {
+	return Open(filename, append([]Option{WithEncoding(encoding)}, opts...)...)
+}
+
+// Open 打开已有的文件，默认读写模式、gbk编码，可以通过ReadOnly()以只读模式打开
+func Open(filename string, opts ...Option) (dbf *DBF, err error) {
+	dbf = &DBF{
+		headBuff: make([]byte, 32),
+		filename: filename,
+		currentRecordNo: 0,
+		eof: true,
+		append: false,
+		encoding: defaultEncoding,
+	}
+	dbf.applyOptions(opts)
+	flag := os.O_RDWR
+	if dbf.readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(filename, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	dbf.reader = f
+	if dbf.readOnly {
+		// 只读模式不需要文件锁，关闭的时候通过reader关闭
+		dbf.file = nil
+	} else {
+		dbf.file = f
+		dbf.filelock = newLock(f)
+	}
+	info, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = dbf.load(info.Size()); err != nil {
+		f.Close()
 		return nil, err
 	}
+	if dbf.hasMemo() {
+		// 备注文件不存在的时候，其余字段仍然可以正常读取，读取备注字段时报错
+		dbf.memo, _ = openMemoFile(filename, memoFormatOf(fileType(dbf.head.fileType)), dbf.readOnly)
+	}
+	return dbf, nil
+}
+
+// NewReader 从任意数据源读取DBF，比如bytes.Reader、embed.FS里的文件、mmap，只能读不能写
+func NewReader(r io.ReaderAt, size int64, encoding string, opts ...Option) (dbf *DBF, err error) {
 	dbf = &DBF{
 		headBuff: make([]byte, 32),
-		file:     f,
-		filename: filename,
+		reader: io.NewSectionReader(r, 0, size),
 		currentRecordNo: 0,
 		eof: true,
-		encoder: mahonia.NewEncoder(encoding),
-		decoder: mahonia.NewDecoder(encoding),
 		append: false,
-		filelock: newLock(f),
+		encoding: encoding,
 	}
+	dbf.applyOptions(opts)
+	dbf.readOnly = true
+	if err = dbf.load(size); err != nil {
+		return nil, err
+	}
+	return dbf, nil
+}
+
+// 初始化编码，读取文件头和字段描述，检查文件结构
+func (dbf *DBF)load(size int64) (err error) {
 	err = dbf.readHead()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if dbf.encoding == "" && dbf.textEncoding == nil {
+		if dbf.encoding, err = dbf.detectEncoding(); err != nil {
+			return err
+		}
+	}
+	if err = dbf.setupEncoding(); err != nil {
+		return err
 	}
 	err = dbf.readFields()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err = dbf.checkRecordSize(size); err != nil {
+		return err
+	}
+	if err = dbf.checkFileSize(size); err != nil {
+		return err
 	}
 	dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
 	dbf.eof = dbf.head.recordCount == 0
-	return dbf, nil
+	return nil
+}
+
+// 没有指定编码时，依次按同名的.cpg文件（需要WithCPGFile）、dBase 7的语言驱动名称、文件头的语言驱动ID推断编码，都没有时使用默认的gbk。
+// 语言驱动指定的代码页不支持时返回ErrUnknownEncoding，需要调用方指定编码
+func (dbf *DBF)detectEncoding() (string, error) {
+	if dbf.useCPG && dbf.filename != "" {
+		if encoding := encodingOfCPG(dbf.filename); encoding != "" {
+			return encoding, nil
+		}
+	}
+	if encoding, err := encodingOfLanguageDriverName(dbf.languageDriverName); encoding != "" || err != nil {
+		return encoding, err
+	}
+	if encoding, err := encodingOfLanguageDriver(dbf.LanguageDriver()); encoding != "" || err != nil {
+		return encoding, err
+	}
+	return defaultEncoding, nil
+}
+
+// Encoding 文件使用的编码，打开时没有指定编码的话是自动推断出来的编码
+func (dbf *DBF)Encoding() string {
+	return dbf.encoding
+}
+
+// 只读模式下的写操作返回ErrReadOnly
+func (dbf *DBF)checkWritable() error {
+	if dbf.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func (dbf *DBF)hasMemo() bool {
+	for _, field := range dbf.fieldsList {
+		if field.isMemo() {
+			return true
+		}
+	}
+	return false
 }
 
 func (dbf *DBF)readHead() error {
-	_, err := dbf.file.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
+	if dbf.batch != nil {
+		// 批量新增期间文件头要到Commit才更新，内存里的记录数才是准确的，不能用文件里的覆盖；
+		// 把缓冲区的记录先写到文件里，读取记录的时候才能读到
+		return dbf.batch.Flush()
+	}
+	// NewFile之后还没有SaveNewFile，没有文件可以读
+	if dbf.reader == nil {
+		return file_not_saved
+	}
+	_, err := dbf.reader.ReadAt(dbf.headBuff, 0)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &CorruptError{Err: ErrTruncatedHeader, Detail: "file is shorter than 32 bytes"}
 	}
-	_, err = dbf.file.Read(dbf.headBuff)
 	if err != nil {
 		return err
 	}
@@ -77,26 +213,31 @@ func (dbf *DBF)readHead() error {
 		recordSize:  binary.LittleEndian.Uint16(dbf.headBuff[10:12]),
 		reserved:    dbf.headBuff[12:32],
 	}
+	if dbf.recovered != nil {
+		dbf.head.recordSize = dbf.recovered.recordSize
+		dbf.head.recordCount = min(dbf.head.recordCount, dbf.recovered.recordCount)
+	}
+	if dbf.isDBase7() {
+		return dbf.readLanguageDriverName()
+	}
 	return nil
 }
 
 func (dbf *DBF)readFields() error {
-	//先偏移到字段结构开始的地方
-	_, err := dbf.file.Seek(32, io.SeekStart)
+	// 字段描述从第32位开始，每个字段32位(dBase 7是48位)，一直读到文件头结束标志0x0D为止
+	// VFP文件在结束标志之后还有263位的backlink，dBase III有的文件结束标志之后还有一位0x00
+	descriptors, err := dbf.scanFieldDescriptors()
 	if err != nil {
 		return err
 	}
-	// 字段个数，每个字段32位，DBF文件头固定32位，文件头结束标志0x0D占1位
-	fieldsCount := (dbf.head.dataOffset - 32 -1) / 32
-	dbf.fieldsMap = make(map[string]dbfField, fieldsCount)
-	for i:=0; i<int(fieldsCount); i++ {
-		fieldBuff := make([]byte, 32)
-		_, err = dbf.file.Read(fieldBuff)
-		if err != nil {
-			return err
+	fields := make([]dbfField, 0, len(descriptors))
+	for _, fieldBuff := range descriptors {
+		if dbf.isDBase7() {
+			fields = append(fields, dbf.newField7(fieldBuff))
+			continue
 		}
-		field := dbfField{
-			name:              dbf.decoder.ConvertString(strings.TrimSpace(strings.Trim(bytes2str(fieldBuff[:11]), bytes2str([]byte{0})))),
+		fields = append(fields, dbfField{
+			name:              strings.TrimSpace(strings.Trim(dbf.decodeName(fieldBuff[:11]), bytes2str([]byte{0}))),
 			fieldType:         fieldType(fieldBuff[11]),
 			displacement:      binary.LittleEndian.Uint32(fieldBuff[12:16]),
 			length:            fieldBuff[16],
@@ -105,17 +246,27 @@ func (dbf *DBF)readFields() error {
 			autoincrementNext: binary.LittleEndian.Uint32(fieldBuff[19:23]),
 			autoincrementStep: fieldBuff[23],
 			reserved:          fieldBuff[24:32],
-		}
-		dbf.fieldsList = append(dbf.fieldsList, field)
+		})
+	}
+	// dBase III的字段描述里保存的是内存地址，不是字段的位置，按字段顺序计算
+	if err = dbf.layoutReadFields(fields); err != nil {
+		return err
+	}
+	dbf.fieldsList = fields
+	dbf.fieldsMap = make(map[string]dbfField, len(fields))
+	dbf.foldedNames = make(map[string]string, len(fields))
+	for _, field := range fields {
 		dbf.fieldsMap[field.name] = field
+		dbf.foldedNames[foldFieldName(field.name)] = field.name
 	}
 	dbf.fieldsCount = len(dbf.fieldsList)
+	dbf.assignNullBits()
 	return nil
 }
 
 func (dbf *DBF)Go(recordNo uint32) error {
 	// 定位的行数，从1开始，以数据条数结尾
-	if recordNo <= 0 {
+	if recordNo <= 0 || dbf.reader == nil {
 		return record_index_out_of_range
 	}
 	//如果发现到文件尾了，重新读取一下文件头，有可能有新数据写进来
@@ -129,15 +280,13 @@ func (dbf *DBF)Go(recordNo uint32) error {
 		return record_index_out_of_range
 	}
 	//读取数据记录
-	_, err := dbf.file.Seek(int64(dbf.head.dataOffset) + int64(recordNo - 1) * int64(dbf.head.recordSize), io.SeekStart)
-	if err != nil {
-		return err
-	}
-	_, err = dbf.file.Read(dbf.recordBuff)
+	_, err := dbf.reader.ReadAt(dbf.recordBuff, int64(dbf.head.dataOffset) + int64(recordNo - 1) * int64(dbf.head.recordSize))
 	if err != nil {
 		return err
 	}
 	dbf.currentRecordNo = recordNo
+	dbf.append = false
+	dbf.memoBuff = nil
 	dbf.eof = dbf.currentRecordNo >= dbf.head.recordCount
 	return nil
 }
@@ -159,8 +308,23 @@ func (dbf *DBF)Next() error {
 }
 
 func (dbf *DBF)Close() error {
+	// 没有提交的批量新增，先提交
+	var err error
+	if dbf.batch != nil {
+		err = dbf.Commit()
+	}
+	if dbf.memo != nil {
+		dbf.memo.close()
+	}
 	if dbf.file != nil {
-		return dbf.file.Close()
+		if closeErr := dbf.file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	// 只读模式打开的文件，NewReader的数据源由调用方关闭
+	if f, ok := dbf.reader.(*os.File); ok {
+		return f.Close()
 	}
 	return nil
 }
@@ -169,82 +333,137 @@ func (dbf *DBF)RecordCount() uint32 {
 	return dbf.head.recordCount
 }
 
+// FieldNames 所有字段的名称，默认不包括_NullFlags之类的系统字段，见ShowSystemFields
 func (dbf *DBF)FieldNames() []string {
 	var fieldNames []string
 	for _, f := range dbf.fieldsList {
+		if f.isSystem() && !dbf.showSystemFields {
+			continue
+		}
 		fieldNames = append(fieldNames, f.name)
 	}
 	return fieldNames
 }
 
+// FieldsCount 字段个数，和FieldNames一致
 func (dbf *DBF)FieldsCount() int {
-	return dbf.fieldsCount
+	if dbf.showSystemFields {
+		return dbf.fieldsCount
+	}
+	count := 0
+	for _, f := range dbf.fieldsList {
+		if !f.isSystem() {
+			count++
+		}
+	}
+	return count
 }
 
 func (dbf *DBF)StringValueByName(fieldname string) (value string, err error) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return "", field_not_exists
 	}
-	return strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), nil
+	value, err = dbf.fieldString(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
 }
 
 func (dbf *DBF)DecimalValueByName(fieldname string) (value decimal.Decimal, err error) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return decimal.Zero, field_not_exists
 	}
-	return decimal.NewFromString(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, err = dbf.fieldDecimal(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
 }
 
 func (dbf *DBF)DecimalValueByNameX(fieldname string) (value decimal.Decimal) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return decimal.Zero
 	}
-	value, _ = decimal.NewFromString(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, _ = dbf.fieldDecimal(dbf.recordBuff, field)
 	return value
 }
 
 func (dbf *DBF)StringValueByNameX(fieldname string) (value string) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return ""
 	}
-	return strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)])))
+	value, _ = dbf.fieldString(dbf.recordBuff, field)
+	return value
 }
 
 func (dbf *DBF)IntValueByName(fieldname string) (value int, err error) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return 0, field_not_exists
 	}
-	return strconv.Atoi(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, err = dbf.fieldInt(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
 }
 
 func (dbf *DBF)IntValueByNameX(fieldname string) (value int) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return 0
 	}
-	value, _ = strconv.Atoi(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, _ = dbf.fieldInt(dbf.recordBuff, field)
 	return value
 }
 
 func (dbf *DBF)FloatValueByName(fieldname string) (value float64, err error) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return 0, field_not_exists
 	}
-	return strconv.ParseFloat(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), 64)
+	value, err = dbf.fieldFloat(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
 }
 
 func (dbf *DBF)FloatValueByNameX(fieldname string) (value float64) {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return 0
 	}
-	value, _ = strconv.ParseFloat(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), 64)
+	value, _ = dbf.fieldFloat(dbf.recordBuff, field)
+	return value
+}
+
+func (dbf *DBF)DateValueByName(fieldname string) (value time.Time, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return time.Time{}, field_not_exists
+	}
+	value, err = dbf.fieldDate(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)DateValueByNameX(fieldname string) (value time.Time) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return time.Time{}
+	}
+	value, _ = dbf.fieldDate(dbf.recordBuff, field)
+	return value
+}
+
+func (dbf *DBF)BoolValueByName(fieldname string) (value bool, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return false, field_not_exists
+	}
+	value, err = dbf.fieldBool(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)BoolValueByNameX(fieldname string) (value bool) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return false
+	}
+	value, _ = dbf.fieldBool(dbf.recordBuff, field)
 	return value
 }
 
@@ -254,31 +473,122 @@ func (dbf *DBF)IsDeleted() bool {
 
 func (dbf *DBF)Append()  {
 	dbf.append = true
+	dbf.memoBuff = nil
 	dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
 	for _, field := range dbf.fieldsList {
 		switch field.fieldType {
 		case fieldtype_float:
 			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
 		case fieldtype_logical:
-			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
+			// 逻辑字段只能是T/F/Y/N/?或者空白，新记录是空白，表示未初始化
 		case fieldtype_numeric:
 			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
+		case fieldtype_integer, fieldtype_double, fieldtype_currency, fieldtype_dateTime, fieldtype_timestamp, fieldtype_autoincrement, fieldtype_double7:
+			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], make([]byte, field.length))
+		case fieldtype_nullFlags:
+			// 新记录的字段都不是NULL
+			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], make([]byte, field.length))
+		case fieldtype_memo, fieldtype_blob:
+			putMemoBlock(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], 0)
 		default:
 			//其余的全部当成字符串处理, 不需要做任何操作，默认空字符串
 		}
 	}
+	// 变长字段的长度记在_NullFlags里，_NullFlags清零之后再写
+	for _, field := range dbf.fieldsList {
+		if field.isVarlength() {
+			dbf.putVarlength(field, nil)
+		}
+	}
 }
 
 func (dbf *DBF)SetFieldValue(fieldname string, value string) error {
-	field, ok := dbf.fieldsMap[fieldname]
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return field_not_exists
+	}
+	return dbf.setField(field, value)
+}
+
+// 日期字段写入YYYYMMDD，日期时间字段写入儒略日和毫秒数，零值写入空日期
+func (dbf *DBF)SetDateValue(fieldname string, value time.Time) error {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return field_not_exists
+	}
+	return dbf.setField(field, formatDate(field, value))
+}
+
+// 逻辑字段写入T/F，数值字段写入1/0
+func (dbf *DBF)SetBoolValue(fieldname string, value bool) error {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return field_not_exists
+	}
+	return dbf.setField(field, formatBool(field, value))
+}
+
+// 按字段的长度和小数位数格式化
+func (dbf *DBF)SetIntValue(fieldname string, value int) error {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return field_not_exists
+	}
+	return dbf.setField(field, formatDecimal(field, decimal.NewFromInt(int64(value))))
+}
+
+// 按字段的长度和小数位数格式化
+func (dbf *DBF)SetDecimalValue(fieldname string, value decimal.Decimal) error {
+	field, ok := dbf.lookupField(fieldname)
 	if !ok {
 		return field_not_exists
 	}
-	copy(dbf.recordBuff[field.displacement: field.displacement + uint32(field.length)], str2bytes(dbf.encoder.ConvertString(value)))
+	return dbf.setField(field, formatDecimal(field, value))
+}
+
+func (dbf *DBF)setField(field dbfField, value string) error {
+	if field.isMemo() {
+		// 备注内容在Post的时候才写入备注文件
+		if err := dbf.setMemoValue(field, value); err != nil {
+			return &FieldValueError{Field: field.name, Value: value, Err: err}
+		}
+		dbf.setNullBit(field, false)
+		return nil
+	}
+	if field.isVarlength() {
+		// 截断的时候既有内容也有错误，和字符字段一样
+		err := dbf.setVarlength(field, value)
+		if err != ErrValueOverflow && err != ErrUnencodableValue {
+			dbf.setNullBit(field, false)
+		}
+		if err != nil {
+			return &FieldValueError{Field: field.name, Value: value, Err: err}
+		}
+		return nil
+	}
+	if field.isBinary() {
+		if err := dbf.encodeBinary(dbf.recordBuff[field.displacement: field.displacement + uint32(field.length)], field, value); err != nil {
+			return &FieldValueError{Field: field.name, Value: value, Err: err}
+		}
+		dbf.setNullBit(field, false)
+		return nil
+	}
+	b, err := dbf.encodeText(field, value)
+	if b != nil {
+		// 截断的时候既有内容也有错误，内容照样写入
+		copy(dbf.recordBuff[field.displacement: field.displacement + uint32(field.length)], b)
+		dbf.setNullBit(field, false)
+	}
+	if err != nil {
+		return &FieldValueError{Field: field.name, Value: value, Err: err}
+	}
 	return nil
 }
 
 func (dbf *DBF)Post() (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
 	if dbf.fieldsCount <= 0 {
 		return empty_fields
 	}
@@ -288,69 +598,151 @@ func (dbf *DBF)Post() (err error) {
 			return err
 		}
 	}
-	if err = dbf.filelock.lock(); err != nil {
+	if dbf.batch != nil {
+		return dbf.postBatch()
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	defer dbf.unlock()
+	if err = dbf.flushMemo(); err != nil {
 		return err
 	}
-	defer dbf.filelock.unlock()
 	if !dbf.append {
 		// update
-		_, err = dbf.file.WriteAt(dbf.recordBuff, int64(dbf.head.dataOffset) + int64(dbf.currentRecordNo - 1) * int64(dbf.head.recordSize))
-		return nil
+		if _, err = dbf.file.WriteAt(dbf.recordBuff, dbf.recordOffset(dbf.currentRecordNo)); err != nil {
+			return err
+		}
+		return dbf.writeHeadDate(dbf.now())
 	}
 	// 新增数据
 	// 先把数据写进去，需要重新读取一下头部，不然有可能加锁写之前，有其它进程已经写了新数据进来
 	if err = dbf.readHead(); err != nil {
 		return err
 	}
+	autoincrement := dbf.hasAutoincrement()
+	if autoincrement {
+		// 自增字段在文件锁里分配，保证多个进程新增时不会重复
+		if err = dbf.readAutoincrement(); err != nil {
+			return err
+		}
+		dbf.assignAutoincrement()
+	}
 	if _, err = dbf.file.WriteAt(append(dbf.recordBuff, fileTerminator), int64(dbf.head.dataOffset) + int64(dbf.head.recordCount) * int64(dbf.head.recordSize)); err != nil {
 		return err
 	}
-	//更新头信息里面的数据条数
-	recordCountBuff := make([]byte, 4)
-	binary.LittleEndian.PutUint32(recordCountBuff, dbf.head.recordCount+1)
-	_, err = dbf.file.WriteAt(recordCountBuff, 4)
-	return err
+	if autoincrement {
+		if err = dbf.writeAutoincrement(); err != nil {
+			return err
+		}
+	}
+	//更新头信息里面的数据条数和修改日期
+	dbf.head.recordCount += 1
+	// 新增的记录成为当前记录，接着Delete、Recall或者修改之后再Post都是针对这条记录
+	dbf.currentRecordNo = dbf.head.recordCount
+	dbf.append = false
+	dbf.eof = true
+	return dbf.writeHeadUpdate(dbf.now())
+}
+
+// Locked 在一次加锁里执行fn，fn里的Post、Delete等写操作不再单独加锁和释放锁，
+// 适合先查找再逐条修改的场景，fn返回之前其它进程不能修改文件。fn里不能调用Pack
+//
+//	err := dbf.Locked(func() error {
+//		for _, recordNo := range recordNos {
+//			if err := dbf.Go(recordNo); err != nil {
+//				return err
+//			}
+//			if err := dbf.Delete(); err != nil {
+//				return err
+//			}
+//		}
+//		return nil
+//	})
+func (dbf *DBF)Locked(fn func() error) (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.file == nil {
+		return empty_fields
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	defer dbf.unlock()
+	return fn()
+}
+
+// 加文件锁，已经持有锁的时候只增加嵌套层数
+func (dbf *DBF)lock() error {
+	if dbf.lockDepth == 0 {
+		if err := dbf.filelock.lock(); err != nil {
+			return err
+		}
+	}
+	dbf.lockDepth++
+	return nil
+}
+
+// 释放文件锁，最外层释放的时候才真正解锁
+func (dbf *DBF)unlock() {
+	dbf.lockDepth--
+	if dbf.lockDepth == 0 {
+		dbf.filelock.unlock()
+	}
 }
 
-func NewFile(filename string, encoding string) *DBF {
-	return &DBF{
+func NewFile(filename string, encoding string, opts ...Option) (*DBF, error) {
+	if encoding == "" {
+		encoding = defaultEncoding
+	}
+	dbf := &DBF{
 		head:           dbfHeader{
 			fileType:    byte(foxBASE_III_NoMemo),
-			updateYear:  byte(time.Now().Year() - 1900),
-			updateMonth: byte(time.Now().Month()),
-			updateDay:   byte(time.Now().Day()),
 			recordCount: 0,
 			dataOffset:  0,
 			recordSize:  1,  //删除标记
-			reserved:    nil,
+			reserved:    make([]byte, 20),
 		},
 		headBuff:        make([]byte, 32),
 		file:            nil,
 		filename:        filename,
 		currentRecordNo: 0,
 		fieldsMap:       make(map[string]dbfField),
+		foldedNames:     make(map[string]string),
 		fieldsList:      make([]dbfField, 0),
 		fieldsCount:     0,
 		recordBuff:      make([]byte, 0),
 		eof:             true,
-		encoder:         mahonia.NewEncoder(encoding),
-		decoder:         mahonia.NewDecoder(encoding),
+		encoding:        encoding,
 		append:          false,
 		filelock:        nil,
 	}
+	dbf.applyOptions(opts)
+	if err := dbf.setupEncoding(); err != nil {
+		return nil, err
+	}
+	// 第30位是语言驱动ID，按编码写入，其它程序打开的时候可以知道文件的编码
+	dbf.head.reserved[17] = languageDriverOf(dbf.encoding)
+	now := dbf.now()
+	dbf.head.updateYear = byte(now.Year() - 1900)
+	dbf.head.updateMonth = byte(now.Month())
+	dbf.head.updateDay = byte(now.Day())
+	return dbf, nil
 }
 
-func (dbf *DBF) addField(fieldName string, fieldType fieldType, length uint8, precision uint8) {
-	// 第1位是删除标记
-	var displacement uint32 = 1
-	if dbf.fieldsCount > 0 {
-		prevField := dbf.fieldsList[dbf.fieldsCount - 1]
-		displacement = prevField.displacement + uint32(prevField.length)
+func (dbf *DBF) addField(fieldName string, fieldType fieldType, length uint8, precision uint8) error {
+	// dBase的字段名不区分大小写，只是大小写不同的字段名也算重复
+	folded := foldFieldName(fieldName)
+	if _, ok := dbf.foldedNames[folded]; ok {
+		if dbf.fieldErr == nil {
+			dbf.fieldErr = duplicate_field
+		}
+		return duplicate_field
 	}
 	field := dbfField{
 		name:              fieldName,
 		fieldType:         fieldType,
-		displacement:      displacement,
 		length:            length,
 		decimalPlaces:     precision,
 		flag:              0,
@@ -360,10 +752,52 @@ func (dbf *DBF) addField(fieldName string, fieldType fieldType, length uint8, pr
 	}
 	dbf.fieldsList = append(dbf.fieldsList, field)
 	dbf.fieldsCount += 1
-	dbf.fieldsMap[field.name] = field
-	dbf.head.recordSize = dbf.head.recordSize + uint16(length)
-	//32位长度的header + 字段描述个数 * 每个字段描述32位长度 + 1位文件头结束符
-	dbf.head.dataOffset = uint16(32 + 32 * dbf.fieldsCount + 1)
+	dbf.foldedNames[folded] = fieldName
+	dbf.layoutFields()
+	return nil
+}
+
+// 重新计算每个字段的位置、记录长度和数据开始的位置
+func (dbf *DBF) layoutFields() {
+	dbf.layoutNullFlags()
+	// 第1位是删除标记
+	var displacement uint32 = 1
+	for i := range dbf.fieldsList {
+		dbf.fieldsList[i].displacement = displacement
+		displacement += uint32(dbf.fieldsList[i].length)
+	}
+	dbf.assignNullBits()
+	dbf.head.recordSize = uint16(displacement)
+	//32位长度的header + 字段描述个数 * 每个字段描述32位长度(dBase 7是语言驱动名称之后每个48位) + 1位文件头结束符
+	dbf.head.dataOffset = uint16(dbf.fieldDescriptorOffset(dbf.fieldsCount) + 1)
+	if dbf.isVisualFoxPro() {
+		dbf.head.dataOffset += backlinkSize
+	}
+}
+
+func (dbf *DBF) isVisualFoxPro() bool {
+	t := fileType(dbf.head.fileType)
+	return t == foxPro || t == foxProAutoincrement
+}
+
+// VFP字段类型只能用在VFP文件里，新文件里出现VFP字段时把文件类型改成VFP，备注字段的块号改成4位二进制
+func (dbf *DBF) useVisualFoxPro() {
+	if dbf.isVisualFoxPro() {
+		return
+	}
+	if dbf.isDBase7() {
+		if dbf.fieldErr == nil {
+			dbf.fieldErr = unsupported_field_type
+		}
+		return
+	}
+	dbf.head.fileType = byte(foxPro)
+	for i := range dbf.fieldsList {
+		if dbf.fieldsList[i].isMemo() {
+			dbf.fieldsList[i].length = 4
+		}
+	}
+	dbf.layoutFields()
 }
 
 func (dbf *DBF)AddBooleanField(fieldName string) {
@@ -386,13 +820,93 @@ func (dbf *DBF)AddFloatField(fieldName string, length uint8, precision uint8) {
 	dbf.addField(fieldName, fieldtype_float, length, precision)
 }
 
+// 备注字段，新文件默认生成dBase III格式的.DBT备注文件，dBase 7文件生成dBase IV格式的.DBT备注文件，VFP文件生成.FPT备注文件
+func (dbf *DBF)AddMemoField(fieldName string) {
+	if dbf.isVisualFoxPro() {
+		dbf.addField(fieldName, fieldtype_memo, 4, 0)
+		return
+	}
+	switch fileType(dbf.head.fileType) {
+	case foxBASE_III_NoMemo:
+		dbf.head.fileType = byte(foxBASE_III_Memo)
+	case dbase7:
+		dbf.head.fileType = byte(dbase7_Memo)
+	}
+	dbf.addField(fieldName, fieldtype_memo, 10, 0)
+}
+
+// 以下是VFP字段类型，添加之后新文件会保存成VFP格式，整数、浮点数和日期时间字段在dBase 7文件里使用dBase 7的类型
+
+func (dbf *DBF)AddIntegerField(fieldName string) {
+	if !dbf.isDBase7() {
+		dbf.useVisualFoxPro()
+	}
+	dbf.addField(fieldName, fieldtype_integer, 4, 0)
+}
+
+func (dbf *DBF)AddDoubleField(fieldName string, precision uint8) {
+	if dbf.isDBase7() {
+		dbf.addField(fieldName, fieldtype_double7, 8, precision)
+		return
+	}
+	dbf.useVisualFoxPro()
+	dbf.addField(fieldName, fieldtype_double, 8, precision)
+}
+
+func (dbf *DBF)AddCurrencyField(fieldName string) {
+	dbf.useVisualFoxPro()
+	dbf.addField(fieldName, fieldtype_currency, 8, 4)
+}
+
+func (dbf *DBF)AddDateTimeField(fieldName string) {
+	if dbf.isDBase7() {
+		dbf.AddTimestampField(fieldName)
+		return
+	}
+	dbf.useVisualFoxPro()
+	dbf.addField(fieldName, fieldtype_dateTime, 8, 0)
+}
+
 func (dbf *DBF)FileName() string {
 	return dbf.filename
 }
 
 func (dbf *DBF)SaveNewFile() (err error) {
-	// 32位文件头，dbf.fieldsCount * 32位字段长度，1位文件头结束标记，1位文件尾结束标记
-	fileBuff := make([]byte, 32 + dbf.fieldsCount * 32 + 1 + 1)
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.fieldErr != nil {
+		return dbf.fieldErr
+	}
+	fileBuff := append(dbf.headerBytes(), fileTerminator)
+	dbf.headBuff = fileBuff[:32]
+	if len(dbf.recordBuff) == 0 {
+		dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
+	}
+	f, err := os.OpenFile(dbf.filename, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	dbf.file = f
+	dbf.reader = f
+	if dbf.hasMemo() {
+		if dbf.memo, err = createMemoFile(dbf.filename, memoFormatOf(fileType(dbf.head.fileType))); err != nil {
+			return err
+		}
+	}
+	dbf.filelock = newLock(dbf.file)
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	defer dbf.unlock()
+	_, err = dbf.file.Write(fileBuff)
+	return err
+}
+
+// 文件头、字段描述和文件头结束标记，VFP文件还包括263位的backlink
+func (dbf *DBF)headerBytes() []byte {
+	// 32位文件头，dbf.fieldsCount * 32位字段长度，1位文件头结束标记，(VFP的263位backlink)
+	fileBuff := make([]byte, int(dbf.head.dataOffset))
 	// 新文件的头
 	fileBuff[0] = dbf.head.fileType
 	fileBuff[1] = dbf.head.updateYear
@@ -402,6 +916,14 @@ func (dbf *DBF)SaveNewFile() (err error) {
 	binary.LittleEndian.PutUint16(fileBuff[8:10], dbf.head.dataOffset)
 	binary.LittleEndian.PutUint16(fileBuff[10:12], dbf.head.recordSize)
 	copy(fileBuff[12:32], dbf.head.reserved)
+	if dbf.isVisualFoxPro() && dbf.hasMemo() {
+		// 第29位是VFP的表标志，0x02表示有备注文件
+		fileBuff[28] |= 0x02
+	}
+	if dbf.isDBase7() {
+		dbf.putFields7(fileBuff)
+		return fileBuff
+	}
 	// 字段描述
 	// 字段名，最大10位，如果不足10位，用0x00填充
 	blankFieldName := bytes.Repeat([]byte{null}, 10)
@@ -418,22 +940,53 @@ func (dbf *DBF)SaveNewFile() (err error) {
 		fileBuff[32 + i*32 + 23] = field.autoincrementStep
 		copy(fileBuff[32 + i*32 + 24: 32 + i*32 + 32], blankFieldName)
 	}
-	fileBuff[len(fileBuff)-2] = headerTerminator
-	fileBuff[len(fileBuff)-1] = fileTerminator
-	dbf.headBuff = fileBuff[:32]
-	if len(dbf.recordBuff) == 0 {
-		dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
+	fileBuff[32 + dbf.fieldsCount * 32] = headerTerminator
+	return fileBuff
+}
+
+// LastUpdate 文件头里的最后修改日期，只精确到天
+func (dbf *DBF)LastUpdate() time.Time {
+	year := 1900 + int(dbf.head.updateYear)
+	// 有些程序写的是2000年之后的两位年份，比如21表示2021年
+	if year < 1980 {
+		year += 100
 	}
-	f, err := os.OpenFile(dbf.filename, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
-	if err != nil {
+	return time.Date(year, time.Month(dbf.head.updateMonth), int(dbf.head.updateDay), 0, 0, 0, 0, time.Local)
+}
+
+func (dbf *DBF)now() time.Time {
+	if dbf.clock != nil {
+		return dbf.clock()
+	}
+	return time.Now()
+}
+
+// 修改日期在文件头里的格式，年份从1900年开始算
+func putUpdateDate(buff []byte, now time.Time) {
+	buff[0] = byte(now.Year() - 1900)
+	buff[1] = byte(now.Month())
+	buff[2] = byte(now.Day())
+}
+
+// 更新文件头里的最后修改日期，调用方需要持有文件锁
+func (dbf *DBF)writeHeadDate(now time.Time) error {
+	buff := make([]byte, 3)
+	putUpdateDate(buff, now)
+	if _, err := dbf.file.WriteAt(buff, 1); err != nil {
 		return err
 	}
-	dbf.file = f
-	dbf.filelock = newLock(dbf.file)
-	if err = dbf.filelock.lock(); err != nil {
+	dbf.head.updateYear, dbf.head.updateMonth, dbf.head.updateDay = buff[0], buff[1], buff[2]
+	return nil
+}
+
+// 更新文件头里的最后修改日期和记录数，调用方需要持有文件锁
+func (dbf *DBF)writeHeadUpdate(now time.Time) error {
+	buff := make([]byte, 7)
+	putUpdateDate(buff, now)
+	binary.LittleEndian.PutUint32(buff[3:7], dbf.head.recordCount)
+	if _, err := dbf.file.WriteAt(buff, 1); err != nil {
 		return err
 	}
-	defer dbf.filelock.unlock()
-	_, err = dbf.file.Write(fileBuff)
-	return err
-}
\ No newline at end of file
+	dbf.head.updateYear, dbf.head.updateMonth, dbf.head.updateDay = buff[0], buff[1], buff[2]
+	return nil
+}
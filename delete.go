@@ -0,0 +1,250 @@
+package godbf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Delete 给当前记录打上删除标记，只是逻辑删除，需要Pack之后才会从文件里真正删除
+func (dbf *DBF)Delete() error {
+	return dbf.setDeletedFlag(deletedFlag)
+}
+
+// Recall 恢复当前被逻辑删除的记录
+func (dbf *DBF)Recall() error {
+	return dbf.setDeletedFlag(space)
+}
+
+func (dbf *DBF)setDeletedFlag(flag byte) (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.batch != nil {
+		return batch_in_progress
+	}
+	if dbf.file == nil || dbf.append || dbf.currentRecordNo == 0 {
+		return record_index_out_of_range
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	defer dbf.unlock()
+	// 只写删除标记这一位，不影响其它进程对这条记录其余字段的修改
+	if _, err = dbf.file.WriteAt([]byte{flag}, dbf.recordOffset(dbf.currentRecordNo)); err != nil {
+		return err
+	}
+	dbf.recordBuff[0] = flag
+	return dbf.writeHeadDate(dbf.now())
+}
+
+// Pack 把没有删除的记录写到同目录下的临时文件，再替换原文件，中途出错原文件不受影响。
+// 文件头和字段描述原样保留，备注文件不做整理。Pack之后需要重新定位记录。
+// 替换之后，其它进程里之前打开的DBF还指向被替换掉的旧文件，再写入的内容不会出现在新文件里，需要重新打开
+func (dbf *DBF)Pack() (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.batch != nil {
+		return batch_in_progress
+	}
+	if dbf.file == nil {
+		return empty_fields
+	}
+	// Pack要关闭原文件，释放掉Locked持有的锁
+	if dbf.lockDepth > 0 {
+		return lock_held
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	locked := true
+	defer func() {
+		if locked {
+			dbf.unlock()
+		}
+	}()
+	if err = dbf.readHead(); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dbf.filename), filepath.Base(dbf.filename) + ".pack*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	// 文件头和字段描述原样复制
+	header := make([]byte, dbf.head.dataOffset)
+	if _, err = dbf.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	putUpdateDate(header[1:4], dbf.now())
+	writer := bufio.NewWriter(tmp)
+	if _, err = writer.Write(header); err != nil {
+		return err
+	}
+	size := int64(dbf.head.recordSize)
+	reader := bufio.NewReader(io.NewSectionReader(dbf.file, int64(dbf.head.dataOffset), int64(dbf.head.recordCount) * size))
+	record := make([]byte, size)
+	var count uint32
+	for i := uint32(0); i < dbf.head.recordCount; i++ {
+		if _, err = io.ReadFull(reader, record); err != nil {
+			return err
+		}
+		if record[0] == deletedFlag {
+			continue
+		}
+		if _, err = writer.Write(record); err != nil {
+			return err
+		}
+		count++
+	}
+	if err = writer.WriteByte(fileTerminator); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	recordCountBuff := make([]byte, 4)
+	binary.LittleEndian.PutUint32(recordCountBuff, count)
+	if _, err = tmp.WriteAt(recordCountBuff, 4); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// Windows下不能替换还打开着的文件，只能先释放锁、关闭原文件，再替换，然后重新打开加锁，
+		// 中间的空档里其它进程写入的内容会被替换掉。替换失败时重新打开的还是原文件
+		dbf.unlock()
+		locked = false
+		dbf.file.Close()
+		renameErr := os.Rename(tmpName, dbf.filename)
+		f, openErr := os.OpenFile(dbf.filename, os.O_RDWR, 0666)
+		if openErr != nil {
+			err = fmt.Errorf("%w: %v", file_not_reopened, openErr)
+			return err
+		}
+		dbf.file = f
+		dbf.reader = f
+		dbf.filelock = newLock(f)
+		if err = renameErr; err != nil {
+			return err
+		}
+		if err = dbf.lock(); err != nil {
+			return err
+		}
+		locked = true
+	} else {
+		// 替换和重新打开的过程中一直持有原文件的锁，其它进程不能在中间写入
+		if err = os.Rename(tmpName, dbf.filename); err != nil {
+			return err
+		}
+		f, openErr := os.OpenFile(dbf.filename, os.O_RDWR, 0666)
+		if openErr != nil {
+			return fmt.Errorf("%w: %v", file_not_reopened, openErr)
+		}
+		lock := newLock(f)
+		if err = lock.lock(); err != nil {
+			f.Close()
+			return fmt.Errorf("%w: %v", file_not_reopened, err)
+		}
+		dbf.filelock.unlock()
+		dbf.file.Close()
+		dbf.file = f
+		dbf.reader = f
+		dbf.filelock = lock
+	}
+	if err = dbf.readHead(); err != nil {
+		return err
+	}
+	dbf.currentRecordNo = 0
+	dbf.eof = dbf.head.recordCount == 0
+	return nil
+}
+
+// Zap 清空所有记录，文件头（包括保留区和语言驱动）和字段描述原样保留，备注文件也一起清空
+func (dbf *DBF)Zap() (err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return err
+	}
+	if dbf.batch != nil {
+		return batch_in_progress
+	}
+	if dbf.file == nil {
+		return empty_fields
+	}
+	if err = dbf.lock(); err != nil {
+		return err
+	}
+	defer dbf.unlock()
+	if err = dbf.readHead(); err != nil {
+		return err
+	}
+	if err = dbf.file.Truncate(int64(dbf.head.dataOffset)); err != nil {
+		return err
+	}
+	if _, err = dbf.file.WriteAt([]byte{fileTerminator}, int64(dbf.head.dataOffset)); err != nil {
+		return err
+	}
+	dbf.head.recordCount = 0
+	if err = dbf.writeHeadUpdate(dbf.now()); err != nil {
+		return err
+	}
+	if dbf.memo != nil {
+		if err = dbf.memo.zap(); err != nil {
+			return err
+		}
+	}
+	dbf.currentRecordNo = 0
+	dbf.eof = true
+	return nil
+}
+
+// DeleteWhere 在一次加锁里给所有满足条件的记录打上删除标记，返回新删除的记录数
+func (dbf *DBF)DeleteWhere(match func(*Record) bool) (count int, err error) {
+	if err = dbf.checkWritable(); err != nil {
+		return 0, err
+	}
+	if dbf.batch != nil {
+		return 0, batch_in_progress
+	}
+	if dbf.file == nil {
+		return 0, empty_fields
+	}
+	if err = dbf.lock(); err != nil {
+		return 0, err
+	}
+	defer dbf.unlock()
+	for rec, err := range dbf.Records(SkipDeleted()) {
+		if err != nil {
+			return count, err
+		}
+		if !match(rec) {
+			continue
+		}
+		if _, err = dbf.file.WriteAt([]byte{deletedFlag}, dbf.recordOffset(rec.recordNo)); err != nil {
+			return count, err
+		}
+		if rec.recordNo == dbf.currentRecordNo && !dbf.append {
+			dbf.recordBuff[0] = deletedFlag
+		}
+		count++
+	}
+	if count > 0 {
+		err = dbf.writeHeadDate(dbf.now())
+	}
+	return count, err
+}
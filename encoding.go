@@ -0,0 +1,116 @@
+package godbf
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 按名称查找编码，先按WHATWG的名称(gbk、big5、utf-8、windows-1252等)，再按IANA的名称(IBM437、IBM850等)
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if e, err := htmlindex.Get(name); err == nil {
+		return e, nil
+	}
+	if e, err := ianaindex.IANA.Encoding(name); err == nil && e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, name)
+}
+
+// 编码的名称，不认识的编码返回空
+func encodingName(e encoding.Encoding) string {
+	if name, err := htmlindex.Name(e); err == nil {
+		return name
+	}
+	if name, err := ianaindex.IANA.Name(e); err == nil {
+		return name
+	}
+	return ""
+}
+
+// 初始化编码，WithTextEncoding指定了编码时不再按名称查找
+func (dbf *DBF)setupEncoding() error {
+	if dbf.textEncoding == nil {
+		e, err := lookupEncoding(dbf.encoding)
+		if err != nil {
+			return err
+		}
+		dbf.textEncoding = e
+	} else {
+		dbf.encoding = encodingName(dbf.textEncoding)
+	}
+	dbf.encoder = dbf.textEncoding.NewEncoder()
+	dbf.decoder = dbf.textEncoding.NewDecoder()
+	return nil
+}
+
+var replacementChar = []byte(string(utf8.RuneError))
+
+// 把文件里的内容解码成字符串，非法的字节替换成U+FFFD，严格模式下返回DecodeError
+func (dbf *DBF)decode(b []byte, field string) (string, error) {
+	s, err := dbf.decoder.String(bytes2str(b))
+	if err == nil && strings.ContainsRune(s, utf8.RuneError) && !bytes.Contains(b, replacementChar) {
+		err = ErrInvalidEncoding
+	}
+	if err != nil && dbf.strictEncoding {
+		return "", &DecodeError{Field: field, Value: append([]byte(nil), b...)}
+	}
+	return s, nil
+}
+
+// 字段名解码，字段名不做严格检查
+func (dbf *DBF)decodeName(b []byte) string {
+	s, err := dbf.decoder.String(bytes2str(b))
+	if err != nil {
+		return string(b)
+	}
+	return s
+}
+
+// 把字符串编码成文件的编码，不能表示的字符替换成?，严格模式下返回ErrUnencodableValue
+func (dbf *DBF)encode(s string) (string, error) {
+	out, err := dbf.encoder.String(s)
+	if err == nil {
+		return out, nil
+	}
+	if dbf.strictEncoding {
+		return "", ErrUnencodableValue
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if encoded, err := dbf.encoder.String(string(r)); err == nil {
+			b.WriteString(encoded)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String(), nil
+}
+
+// DecodeError 严格模式下读取到不符合文件编码的内容，RecordNo从1开始，0表示新增还没有提交的记录
+type DecodeError struct {
+	RecordNo uint32
+	Field string
+	Value []byte
+}
+
+func (e *DecodeError) Error() string {
+	return "record " + strconv.FormatUint(uint64(e.RecordNo), 10) + " field " + e.Field + " value " + strconv.Quote(bytes2str(e.Value)) + ": " + ErrInvalidEncoding.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return ErrInvalidEncoding
+}
+
+// 给解码错误补上记录号
+func atRecord(recordNo uint32, err error) error {
+	if decodeErr, ok := err.(*DecodeError); ok {
+		decodeErr.RecordNo = recordNo
+	}
+	return err
+}
@@ -1,10 +1,81 @@
 package godbf
 
-import "errors"
+import (
+	"errors"
+	"strconv"
+)
 
 var (
 	record_index_out_of_range = errors.New("record index out of range")
 	field_not_exists = errors.New("field name not exists")
 	empty_fields = errors.New("no fields found")
 	errLocked = errors.New("file already locked by other process")
-)
\ No newline at end of file
+	memo_file_not_exists = errors.New("memo file not exists")
+	struct_pointer_required = errors.New("value must be a struct or a non-nil pointer to struct")
+	slice_pointer_required = errors.New("destination must be a non-nil pointer to slice of struct")
+	unsupported_struct_field_type = errors.New("unsupported struct field type")
+	invalid_struct_tag = errors.New("invalid dbf struct tag")
+	unsupported_field_type = errors.New("unsupported field type")
+	duplicate_field = errors.New("duplicate field name")
+	field_index_out_of_range = errors.New("field index out of range")
+	memo_not_supported = errors.New("memo fields are not supported by this writer")
+	writer_closed = errors.New("writer already closed")
+	batch_in_progress = errors.New("batch append in progress")
+	no_batch_in_progress = errors.New("no batch append in progress")
+	field_not_nullable = errors.New("field is not nullable")
+	autoincrement_not_integer = errors.New("autoincrement is only supported on integer fields")
+	lock_held = errors.New("can not pack while the file lock is held")
+	record_count_mismatch = errors.New("record count does not match WithRecordCount")
+	file_not_saved = errors.New("new file has not been saved yet")
+	file_not_reopened = errors.New("file could not be reopened after pack, dbf is no longer usable")
+)
+
+// ErrReadOnly 只读模式下调用了写操作
+var ErrReadOnly = errors.New("dbf is opened in read-only mode")
+
+// 写入字段值时的校验错误，通过errors.Is判断具体原因
+var (
+	ErrValueOverflow = errors.New("value overflows field length")
+	ErrInvalidNumeric = errors.New("invalid numeric value")
+	ErrInvalidDate = errors.New("invalid date value")
+	ErrInvalidLogical = errors.New("invalid logical value")
+)
+
+// 编码相关的错误
+var (
+	ErrUnknownEncoding = errors.New("unknown encoding")
+	ErrInvalidEncoding = errors.New("invalid byte sequence for encoding")
+	ErrUnencodableValue = errors.New("value can not be represented in encoding")
+	ErrValueTruncated = errors.New("value truncated to field length")
+)
+
+// 文件结构损坏的错误，打开文件或者读取备注时包在CorruptError里返回
+var (
+	ErrTruncatedHeader = errors.New("file is too short for its header")
+	ErrBadTerminator = errors.New("header terminator 0x0D not found")
+	ErrInconsistentRecordSize = errors.New("field lengths do not match record size")
+	ErrRecordCountMismatch = errors.New("file size does not match record count")
+	ErrTruncatedRecord = errors.New("last record is truncated")
+	ErrBadMemoBlock = errors.New("memo block length exceeds memo file")
+)
+
+// Validate检查记录时的错误
+var (
+	ErrValueRequired = errors.New("value is required")
+	ErrPatternMismatch = errors.New("value does not match pattern")
+)
+
+// FieldValueError 写入字段值失败的详细信息
+type FieldValueError struct {
+	Field string
+	Value string
+	Err error
+}
+
+func (e *FieldValueError) Error() string {
+	return "field " + e.Field + " value " + strconv.Quote(e.Value) + ": " + e.Err.Error()
+}
+
+func (e *FieldValueError) Unwrap() error {
+	return e.Err
+}
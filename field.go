@@ -0,0 +1,311 @@
+package godbf
+
+import "strings"
+
+// Field 字段的描述信息，Offset只在读取的时候有意义，添加字段时忽略
+type Field struct {
+	Name string
+	Type byte  //字段类型，C/N/F/L/D/M/I/B/Y/T/V/Q/W，dBase 7的@/+/O
+	Length uint8
+	DecimalPlaces uint8
+	Offset uint32  //字段在记录里的位置，第0位是删除标记
+	Nullable bool  //VFP，字段可以为NULL
+	Binary bool  //VFP，字符和备注字段不做编码转换
+	Autoincrement bool  //VFP和dBase 7，自增字段
+	AutoincrementNext uint32  //VFP，自增字段的下一个值，添加字段时是初始值，为0时从1开始
+	AutoincrementStep uint8  //VFP，自增字段的步长，添加字段时为0表示1
+}
+
+// VFP字段描述第19位的标志
+const (
+	fieldflag_system byte = 0x01
+	fieldflag_nullable byte = 0x02
+	fieldflag_binary byte = 0x04
+	fieldflag_autoincrement byte = 0x08
+)
+
+func newField(f dbfField) Field {
+	return Field{
+		Name:          f.name,
+		Type:          byte(f.fieldType),
+		Length:        f.length,
+		DecimalPlaces: f.decimalPlaces,
+		Offset:        f.displacement,
+		Nullable:      f.flag & fieldflag_nullable != 0,
+		Binary:        f.flag & fieldflag_binary != 0,
+		Autoincrement: f.isAutoincrement(),
+		AutoincrementNext: f.autoincrementNext,
+		AutoincrementStep: f.autoincrementStep,
+	}
+}
+
+// Fields 按文件里的顺序返回所有字段的描述，系统字段的规则和FieldNames一样
+func (dbf *DBF)Fields() []Field {
+	fields := make([]Field, 0, len(dbf.fieldsList))
+	for _, f := range dbf.fieldsList {
+		if f.isSystem() && !dbf.showSystemFields {
+			continue
+		}
+		fields = append(fields, newField(f))
+	}
+	return fields
+}
+
+// 按字段名查找字段，先按原样查找，找不到再忽略大小写和前后空格查找
+func (dbf *DBF)lookupField(name string) (dbfField, bool) {
+	if field, ok := dbf.fieldsMap[name]; ok || dbf.caseSensitive {
+		return field, ok
+	}
+	field, ok := dbf.fieldsMap[dbf.foldedNames[foldFieldName(name)]]
+	return field, ok
+}
+
+func foldFieldName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+// Field 按字段名返回字段的描述
+func (dbf *DBF)Field(name string) (Field, error) {
+	f, ok := dbf.lookupField(name)
+	if !ok {
+		return Field{}, field_not_exists
+	}
+	return newField(f), nil
+}
+
+// FileType 文件头第1位的文件类型，比如0x03是dBase III，0x30是Visual FoxPro
+func (dbf *DBF)FileType() byte {
+	return dbf.head.fileType
+}
+
+// RecordSize 每一条记录的长度，包括删除标记
+func (dbf *DBF)RecordSize() uint16 {
+	return dbf.head.recordSize
+}
+
+// HeaderSize 文件头的长度，也就是第一条记录在文件里的位置
+func (dbf *DBF)HeaderSize() uint16 {
+	return dbf.head.dataOffset
+}
+
+// LanguageDriver 文件头第30位的语言驱动ID(LDID)，0表示没有设置
+func (dbf *DBF)LanguageDriver() byte {
+	if len(dbf.head.reserved) < 18 {
+		return 0
+	}
+	return dbf.head.reserved[17]
+}
+
+// CodePage 按语言驱动ID对应的代码页，比如936是简体中文GBK，不认识或者没有设置时返回0
+func (dbf *DBF)CodePage() int {
+	return codePages[dbf.LanguageDriver()]
+}
+
+// AddField 按字段描述添加字段，Length为0时C/N/F字段使用默认长度，其余类型的长度是固定的。
+// Nullable的字段会把文件改成VFP格式，NULL标记保存在自动添加的_NullFlags字段里
+func (dbf *DBF)AddField(f Field) error {
+	if _, ok := dbf.foldedNames[foldFieldName(f.Name)]; ok {
+		return duplicate_field
+	}
+	if err := dbf.checkFieldType(f); err != nil {
+		return err
+	}
+	if fieldType(f.Type) == fieldtype_autoincrement {
+		dbf.useDBase7()
+		f.Type = byte(fieldtype_integer)
+		f.Autoincrement = true
+	}
+	if f.Autoincrement {
+		if fieldType(f.Type) != fieldtype_integer {
+			return autoincrement_not_integer
+		}
+		if f.AutoincrementNext == 0 {
+			f.AutoincrementNext = 1
+		}
+		if f.AutoincrementStep == 0 {
+			f.AutoincrementStep = 1
+		}
+		dbf.AddAutoincrementField(f.Name, f.AutoincrementNext, f.AutoincrementStep)
+		if f.Nullable {
+			dbf.setFieldFlag(f.Name, fieldflag_nullable)
+		}
+		return nil
+	}
+	switch fieldType(f.Type) {
+	case fieldtype_character:
+		if f.Length == 0 {
+			f.Length = 254
+		}
+		dbf.AddStringField(f.Name, f.Length)
+	case fieldtype_numeric:
+		if f.Length == 0 {
+			f.Length = 20
+		}
+		dbf.AddNumericField(f.Name, f.Length, f.DecimalPlaces)
+	case fieldtype_float:
+		if f.Length == 0 {
+			f.Length = 20
+		}
+		dbf.AddFloatField(f.Name, f.Length, f.DecimalPlaces)
+	case fieldtype_logical:
+		dbf.AddBooleanField(f.Name)
+	case fieldtype_date:
+		dbf.AddDateField(f.Name)
+	case fieldtype_memo:
+		dbf.AddMemoField(f.Name)
+	case fieldtype_integer:
+		dbf.AddIntegerField(f.Name)
+	case fieldtype_double:
+		dbf.AddDoubleField(f.Name, f.DecimalPlaces)
+	case fieldtype_currency:
+		dbf.AddCurrencyField(f.Name)
+	case fieldtype_dateTime:
+		dbf.AddDateTimeField(f.Name)
+	case fieldtype_varchar:
+		if f.Length == 0 {
+			f.Length = 254
+		}
+		dbf.AddVarcharField(f.Name, f.Length)
+	case fieldtype_varbinary:
+		if f.Length == 0 {
+			f.Length = 254
+		}
+		dbf.AddVarbinaryField(f.Name, f.Length)
+	case fieldtype_blob:
+		dbf.AddBlobField(f.Name)
+	case fieldtype_timestamp:
+		dbf.AddTimestampField(f.Name)
+	case fieldtype_double7:
+		dbf.useDBase7()
+		dbf.AddDoubleField(f.Name, f.DecimalPlaces)
+	default:
+		return unsupported_field_type
+	}
+	if f.Binary {
+		dbf.useVisualFoxPro()
+		dbf.setFieldFlag(f.Name, fieldflag_binary)
+	}
+	if f.Nullable {
+		dbf.useVisualFoxPro()
+		dbf.setFieldFlag(f.Name, fieldflag_nullable)
+	}
+	return nil
+}
+
+// FieldIndex 字段在Fields()里的序号，可以保存下来反复使用，省去每次按字段名查找。
+// 和Fields()一样，默认不算_NullFlags之类隐藏的系统字段
+//
+//	code, _ := dbf.FieldIndex("STOCK_CODE")
+//	for !dbf.EOF() {
+//		_ = dbf.RawValue(code)
+//		dbf.Next()
+//	}
+func (dbf *DBF)FieldIndex(name string) (int, error) {
+	field, ok := dbf.lookupField(name)
+	if !ok {
+		return -1, field_not_exists
+	}
+	idx := 0
+	for _, f := range dbf.fieldsList {
+		hidden := f.isSystem() && !dbf.showSystemFields
+		if f.name == field.name && !hidden {
+			return idx, nil
+		}
+		if !hidden {
+			idx++
+		}
+	}
+	return -1, field_not_exists
+}
+
+// 按Fields()里的序号取字段，隐藏的系统字段不占序号
+func (dbf *DBF)fieldAt(idx int) (dbfField, error) {
+	if idx < 0 {
+		return dbfField{}, field_index_out_of_range
+	}
+	for _, f := range dbf.fieldsList {
+		if f.isSystem() && !dbf.showSystemFields {
+			continue
+		}
+		if idx == 0 {
+			return f, nil
+		}
+		idx--
+	}
+	return dbfField{}, field_index_out_of_range
+}
+
+// RawValue 当前记录里字段的原始内容，不做编码转换也不复制，移动到其它记录之后内容会变化，需要保留的话自己复制一份。
+// 序号超出范围时返回nil
+func (dbf *DBF)RawValue(idx int) []byte {
+	field, err := dbf.fieldAt(idx)
+	if err != nil || len(dbf.recordBuff) == 0 {
+		return nil
+	}
+	return fieldBytes(dbf.recordBuff, field)
+}
+
+func (dbf *DBF)StringValue(idx int) (string, error) {
+	field, err := dbf.fieldAt(idx)
+	if err != nil {
+		return "", err
+	}
+	value, err := dbf.fieldString(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)StringValueX(idx int) (value string) {
+	value, _ = dbf.StringValue(idx)
+	return value
+}
+
+func (dbf *DBF)IntValue(idx int) (int, error) {
+	field, err := dbf.fieldAt(idx)
+	if err != nil {
+		return 0, err
+	}
+	value, err := dbf.fieldInt(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)IntValueX(idx int) (value int) {
+	value, _ = dbf.IntValue(idx)
+	return value
+}
+
+// RawValue 记录里字段的原始内容，不做编码转换也不复制。序号超出范围时返回nil
+func (r *Record)RawValue(idx int) []byte {
+	field, err := r.dbf.fieldAt(idx)
+	if err != nil {
+		return nil
+	}
+	return fieldBytes(r.buff, field)
+}
+
+func (r *Record)StringValue(idx int) (string, error) {
+	field, err := r.dbf.fieldAt(idx)
+	if err != nil {
+		return "", err
+	}
+	value, err := r.dbf.fieldString(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)StringValueX(idx int) (value string) {
+	value, _ = r.StringValue(idx)
+	return value
+}
+
+func (r *Record)IntValue(idx int) (int, error) {
+	field, err := r.dbf.fieldAt(idx)
+	if err != nil {
+		return 0, err
+	}
+	value, err := r.dbf.fieldInt(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)IntValueX(idx int) (value int) {
+	value, _ = r.IntValue(idx)
+	return value
+}
@@ -1,12 +1,23 @@
 package godbf
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func BenchmarkNewDBF_Append(b *testing.B) {
-	dbf := NewFile("./testdata/test_append.dbf", "gbk")
+	dbf := newTestFile(b, "./testdata/test_append.dbf", "gbk")
 	defer dbf.Close()
 	dbf.AddDateField("BEGIN_DATE")
 	dbf.AddDateField("END_DATE")
@@ -26,6 +37,33 @@ func BenchmarkNewDBF_Append(b *testing.B) {
 	}
 }
 
+func BenchmarkNewDBF_BatchAppend(b *testing.B) {
+	dbf := newTestFile(b, "./testdata/test_batch_append.dbf", "gbk")
+	defer dbf.Close()
+	dbf.AddDateField("BEGIN_DATE")
+	dbf.AddDateField("END_DATE")
+	dbf.AddFloatField("PRICE", 12, 2)
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddBooleanField("FINISHED")
+	dbf.AddStringField("STOCK_CODE", 20)
+	if err := dbf.BeginBatch(); err != nil {
+		b.Fatal(err)
+	}
+	for i:=0; i<b.N; i++ {
+		dbf.Append()
+		dbf.SetFieldValue("BEGIN_DATE", "20201213")
+		dbf.SetFieldValue("END_DATE", "20210605")
+		dbf.SetFieldValue("PRICE", "12.34")
+		dbf.SetFieldValue("QTY", strconv.FormatInt(int64(i), 10))
+		dbf.SetFieldValue("STOCK_CODE", "600570")
+		dbf.SetFieldValue("FINISHED", "1")
+		dbf.Post()
+	}
+	if err := dbf.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
 func BenchmarkDBF_Next(b *testing.B) {
 	dbf, err := LoadFrom("./testdata/test_5million.DBF", "gbk")
 	if err != nil {
@@ -43,6 +81,28 @@ func BenchmarkDBF_Next(b *testing.B) {
 	}
 }
 
+func BenchmarkDBF_NextFieldIndex(b *testing.B) {
+	dbf, err := LoadFrom("./testdata/test_5million.DBF", "gbk")
+	if err != nil {
+		panic(err)
+	}
+	defer dbf.Close()
+	var fields []int
+	for _, name := range []string{"BEGIN_DATE", "END_DATE", "PRICE", "QTY", "FINISHED", "STOCK_CODE"} {
+		idx, err := dbf.FieldIndex(name)
+		if err != nil {
+			panic(err)
+		}
+		fields = append(fields, idx)
+	}
+	for i := 0; i < b.N; i ++ {
+		dbf.Next()
+		for _, idx := range fields {
+			_ = dbf.RawValue(idx)
+		}
+	}
+}
+
 func BenchmarkDBF_Update(b *testing.B) {
 	dbf, err := LoadFrom("./testdata/test_5million.DBF", "gbk")
 	if err != nil {
@@ -59,4 +119,1510 @@ func BenchmarkDBF_Update(b *testing.B) {
 		dbf.SetFieldValue("STOCK_CODE", "000002")
 		dbf.Post()
 	}
-}
\ No newline at end of file
+}
+func TestMemoField(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "memo.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddStringField("CODE", 6)
+	dbf.AddMemoField("REMARK")
+	dbf.Append()
+	dbf.SetFieldValue("CODE", "600570")
+	dbf.SetFieldValue("REMARK", strings.Repeat("备注", 300))
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err = dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	if v := dbf.StringValueByNameX("REMARK"); v != strings.Repeat("备注", 300) {
+		t.Fatalf("unexpected memo value %q", v)
+	}
+}
+
+func TestMemoFile_Formats(t *testing.T) {
+	for _, format := range []memoFormat{memo_dbase3, memo_dbase4, memo_foxpro} {
+		memo, err := createMemoFile(filepath.Join(t.TempDir(), "memo.dbf"), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, _ := memo.write([]byte("hello"), foxproMemoTypeText)
+		second, _ := memo.write(bytes.Repeat([]byte("x"), 1000), foxproMemoTypeText)
+		if data, _ := memo.read(first); string(data) != "hello" {
+			t.Errorf("format %d: unexpected memo %q", format, data)
+		}
+		if data, _ := memo.read(second); len(data) != 1000 {
+			t.Errorf("format %d: unexpected memo length %d", format, len(data))
+		}
+		// 块头里的长度超出备注文件时报错，不按这个长度分配内存
+		if format != memo_dbase3 {
+			memo.file.WriteAt([]byte{0xFF, 0xFF, 0xFF, 0xF0}, int64(first) * int64(memo.blockSize) + 4)
+			if _, err = memo.read(first); !errors.Is(err, ErrBadMemoBlock) {
+				t.Errorf("format %d: read corrupt block = %v", format, err)
+			}
+		}
+		memo.close()
+	}
+}
+
+func TestVisualFoxProFields(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "vfp.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddMemoField("REMARK")
+	dbf.AddIntegerField("QTY")
+	dbf.AddDoubleField("PRICE", 2)
+	dbf.AddCurrencyField("AMOUNT")
+	dbf.AddDateTimeField("UPDATED")
+	dbf.Append()
+	dbf.SetFieldValue("REMARK", "vfp memo")
+	dbf.SetFieldValue("QTY", "-12")
+	dbf.SetFieldValue("PRICE", "12.5")
+	dbf.SetFieldValue("AMOUNT", "1234.5678")
+	dbf.SetFieldValue("UPDATED", "20210605143000")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.FieldsCount() != 5 {
+		t.Fatalf("unexpected fields count %d", dbf.FieldsCount())
+	}
+	dbf.First()
+	if v := dbf.IntValueByNameX("QTY"); v != -12 {
+		t.Errorf("unexpected integer %d", v)
+	}
+	if v := dbf.FloatValueByNameX("PRICE"); v != 12.5 {
+		t.Errorf("unexpected double %v", v)
+	}
+	if v := dbf.DecimalValueByNameX("AMOUNT"); v.String() != "1234.5678" {
+		t.Errorf("unexpected currency %v", v)
+	}
+	if v := dbf.StringValueByNameX("UPDATED"); v != "20210605143000" {
+		t.Errorf("unexpected datetime %v", v)
+	}
+	if v := dbf.StringValueByNameX("REMARK"); v != "vfp memo" {
+		t.Errorf("unexpected memo %v", v)
+	}
+}
+
+func TestDateTimeMilliseconds(t *testing.T) {
+	updated := time.Date(2021, 6, 5, 14, 30, 0, 250 * int(time.Millisecond), time.Local)
+	for _, dbase7 := range []bool{false, true} {
+		var opts []Option
+		if dbase7 {
+			opts = append(opts, DBaseLevel7())
+		}
+		dbf := newTestFile(t, filepath.Join(t.TempDir(), "datetime.dbf"), "gbk", opts...)
+		dbf.AddDateTimeField("UPDATED")
+		dbf.Append()
+		dbf.SetDateValue("UPDATED", updated)
+		if v := dbf.DateValueByNameX("UPDATED"); !v.Equal(updated) {
+			t.Errorf("dBase 7 %v: UPDATED = %v", dbase7, v)
+		}
+		if v := dbf.StringValueByNameX("UPDATED"); v != "20210605143000.250" {
+			t.Errorf("dBase 7 %v: UPDATED = %q", dbase7, v)
+		}
+		dbf.SetFieldValue("UPDATED", "20210605143000.125")
+		if v := dbf.DateValueByNameX("UPDATED"); !v.Equal(updated.Add(-125 * time.Millisecond)) {
+			t.Errorf("dBase 7 %v: UPDATED = %v", dbase7, v)
+		}
+		dbf.Close()
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	dbf := newTestFile(t, filepath.Join(t.TempDir(), "typed.dbf"), "gbk")
+	defer dbf.Close()
+	dbf.AddDateField("BEGIN_DATE")
+	dbf.AddBooleanField("FINISHED")
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddNumericField("PRICE", 12, 3)
+	dbf.Append()
+	if v := dbf.RawValue(1); string(v) != " " {
+		t.Errorf("new logical value %q", v)
+	}
+	begin := time.Date(2020, 12, 13, 0, 0, 0, 0, time.Local)
+	dbf.SetDateValue("BEGIN_DATE", begin)
+	dbf.SetBoolValue("FINISHED", true)
+	dbf.SetIntValue("QTY", 12)
+	dbf.SetDecimalValue("PRICE", decimal.RequireFromString("12.3456"))
+	if v := dbf.StringValueByNameX("QTY"); v != "12.00" {
+		t.Errorf("unexpected numeric %q", v)
+	}
+	if v := dbf.StringValueByNameX("PRICE"); v != "12.346" {
+		t.Errorf("unexpected numeric %q", v)
+	}
+	if v := dbf.DateValueByNameX("BEGIN_DATE"); !v.Equal(begin) {
+		t.Errorf("unexpected date %v", v)
+	}
+	if !dbf.BoolValueByNameX("FINISHED") {
+		t.Errorf("unexpected boolean false")
+	}
+	dbf.SetDateValue("BEGIN_DATE", time.Time{})
+	if v, err := dbf.DateValueByName("BEGIN_DATE"); err != nil || !v.IsZero() {
+		t.Errorf("unexpected blank date %v, %v", v, err)
+	}
+}
+
+func TestSetFieldValue_Validation(t *testing.T) {
+	dbf := newTestFile(t, filepath.Join(t.TempDir(), "validate.dbf"), "gbk")
+	defer dbf.Close()
+	dbf.AddStringField("STOCK_CODE", 6)
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddDateField("BEGIN_DATE")
+	dbf.Append()
+	dbf.SetFieldValue("STOCK_CODE", "600570")
+	dbf.SetFieldValue("STOCK_CODE", "01")
+	if v := string(fieldBytes(dbf.recordBuff, dbf.fieldsMap["STOCK_CODE"])); v != "01    " {
+		t.Errorf("stale bytes left in character field: %q", v)
+	}
+	dbf.SetFieldValue("QTY", "1.005")
+	if v := string(fieldBytes(dbf.recordBuff, dbf.fieldsMap["QTY"])); v != "    1.01" {
+		t.Errorf("numeric not right-justified or rounded: %q", v)
+	}
+	cases := []struct {
+		field, value string
+		err          error
+	}{
+		{"STOCK_CODE", "6005700", ErrValueOverflow},
+		{"QTY", "123456.78", ErrValueOverflow},
+		{"QTY", "12a", ErrInvalidNumeric},
+		{"BEGIN_DATE", "20211340", ErrInvalidDate},
+	}
+	for _, c := range cases {
+		err := dbf.SetFieldValue(c.field, c.value)
+		var fieldErr *FieldValueError
+		if !errors.Is(err, c.err) || !errors.As(err, &fieldErr) || fieldErr.Field != c.field {
+			t.Errorf("SetFieldValue(%s, %s) = %v, want %v", c.field, c.value, err, c.err)
+		}
+	}
+
+	truncate := newTestFile(t, filepath.Join(t.TempDir(), "truncate.dbf"), "gbk", WithOverflowPolicy(OverflowTruncate))
+	defer truncate.Close()
+	truncate.AddStringField("STOCK_CODE", 6)
+	truncate.Append()
+	if err := truncate.SetFieldValue("STOCK_CODE", "6005700"); err != nil {
+		t.Errorf("unexpected error with truncate policy: %v", err)
+	}
+}
+
+type testQuote struct {
+	StockCode string          `dbf:"STOCK_CODE,C,20"`
+	Price     decimal.Decimal `dbf:"PRICE,N,12,2"`
+	Qty       int             `dbf:"QTY,N,8"`
+	BeginDate time.Time       `dbf:"BEGIN_DATE"`
+	EndDate   *time.Time      `dbf:"END_DATE"`
+	Finished  bool            `dbf:"FINISHED"`
+	Ignored   string
+}
+
+func TestStructMapping(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "struct.dbf")
+	dbf, err := NewFileFromStruct(filename, "gbk", testQuote{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Date(2020, 12, 13, 0, 0, 0, 0, time.Local)
+	quotes := []testQuote{
+		{StockCode: "600570", Price: decimal.RequireFromString("12.34"), Qty: 100, BeginDate: begin, EndDate: &begin, Finished: true},
+		{StockCode: "000002", Price: decimal.RequireFromString("22.2"), Qty: 5, BeginDate: begin},
+	}
+	for _, q := range quotes {
+		if err = dbf.AppendStruct(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Close()
+
+	dbf, err = LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err = dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	var got []testQuote
+	if err = dbf.ReadAll(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(quotes) {
+		t.Fatalf("unexpected records count %d", len(got))
+	}
+	// ReadAll不改变当前记录
+	if dbf.currentRecordNo != 1 || dbf.StringValueByNameX("STOCK_CODE") != "600570" {
+		t.Errorf("ReadAll moved the cursor to %d", dbf.currentRecordNo)
+	}
+	for i := range quotes {
+		want, g := quotes[i], got[i]
+		if g.StockCode != want.StockCode || !g.Price.Equal(want.Price) || g.Qty != want.Qty ||
+			!g.BeginDate.Equal(want.BeginDate) || g.Finished != want.Finished || (g.EndDate == nil) != (want.EndDate == nil) {
+			t.Errorf("record %d: got %+v, want %+v", i+1, g, want)
+		}
+	}
+}
+
+func TestDBF_Records(t *testing.T) {
+	dbf, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	var count uint32
+	for rec, err := range dbf.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if rec.RecordNo() != count {
+			t.Fatalf("unexpected record number %d, want %d", rec.RecordNo(), count)
+		}
+		if rec.StringValueByNameX("jyrq") == "" {
+			t.Fatalf("record %d: empty jyrq", count)
+		}
+	}
+	if count != dbf.RecordCount() {
+		t.Errorf("iterated %d records, want %d", count, dbf.RecordCount())
+	}
+}
+
+func TestDBF_DeleteRecallPack(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pack.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddStringField("STOCK_CODE", 6)
+	for _, code := range []string{"600570", "000002", "600000"} {
+		dbf.Append()
+		dbf.SetFieldValue("STOCK_CODE", code)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	for _, recordNo := range []uint32{1, 2} {
+		dbf.Go(recordNo)
+		if err = dbf.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Go(1)
+	if err = dbf.Recall(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dbf.Pack(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.RecordCount() != 2 {
+		t.Fatalf("unexpected records count %d after pack", dbf.RecordCount())
+	}
+	var codes []string
+	for rec := range dbf.Records() {
+		codes = append(codes, rec.StringValueByNameX("STOCK_CODE"))
+	}
+	if strings.Join(codes, ",") != "600570,600000" {
+		t.Errorf("unexpected records %v after pack", codes)
+	}
+}
+
+func TestDBF_DeleteWhereZap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "zap.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	defer dbf.Close()
+	dbf.AddStringField("STOCK_CODE", 6)
+	for _, code := range []string{"600570", "000002", "600000"} {
+		dbf.Append()
+		dbf.SetFieldValue("STOCK_CODE", code)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 新增提交之后当前记录就是新记录，可以直接删除和恢复
+	dbf.Append()
+	dbf.SetFieldValue("STOCK_CODE", "300750")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Delete(); err != nil {
+		t.Fatalf("Delete after append = %v", err)
+	}
+	if err := dbf.Go(4); err != nil || !dbf.IsDeleted() || dbf.StringValueByNameX("STOCK_CODE") != "300750" {
+		t.Fatalf("record 4 deleted = %v, %v", dbf.IsDeleted(), err)
+	}
+	dbf.Append()
+	dbf.SetFieldValue("STOCK_CODE", "300760")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Recall(); err != nil || dbf.RecordCount() != 5 {
+		t.Fatalf("Recall after append = %v, records %d", err, dbf.RecordCount())
+	}
+	count, err := dbf.DeleteWhere(func(rec *Record) bool {
+		return strings.HasPrefix(rec.StringValueByNameX("STOCK_CODE"), "600")
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("DeleteWhere = %d, %v", count, err)
+	}
+	var deleted int
+	for rec := range dbf.Records() {
+		if rec.IsDeleted() {
+			deleted++
+		}
+	}
+	if deleted != 3 {
+		t.Errorf("unexpected deleted records %d", deleted)
+	}
+	// Locked里的写操作不再单独加锁，Pack要关闭文件，不能在Locked里调用
+	err = dbf.Locked(func() error {
+		if err := dbf.Go(2); err != nil {
+			return err
+		}
+		if err := dbf.Delete(); err != nil {
+			return err
+		}
+		if err := dbf.Pack(); err != lock_held {
+			t.Errorf("Pack inside Locked = %v", err)
+		}
+		return nil
+	})
+	if err != nil || dbf.lockDepth != 0 {
+		t.Fatalf("Locked = %v, lock depth %d", err, dbf.lockDepth)
+	}
+	header := make([]byte, dbf.head.dataOffset)
+	dbf.file.ReadAt(header, 0)
+	if err = dbf.Zap(); err != nil {
+		t.Fatal(err)
+	}
+	zapped := make([]byte, dbf.head.dataOffset)
+	dbf.file.ReadAt(zapped, 0)
+	if dbf.RecordCount() != 0 || !bytes.Equal(header[12:], zapped[12:]) {
+		t.Errorf("unexpected header after zap")
+	}
+}
+
+func TestDBF_Unsaved(t *testing.T) {
+	dbf := newTestFile(t, filepath.Join(t.TempDir(), "unsaved.dbf"), "gbk")
+	dbf.AddStringField("STOCK_CODE", 6)
+	if err := dbf.First(); err != record_index_out_of_range {
+		t.Errorf("First on unsaved file = %v", err)
+	}
+	var errs []error
+	for _, err := range dbf.Records() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] != file_not_saved {
+		t.Errorf("Records on unsaved file = %v", errs)
+	}
+}
+
+func TestDBF_ReadOnly(t *testing.T) {
+	data, err := os.ReadFile("./testdata/ZRTBDQXFL.dbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(bytes.NewReader(data), int64(len(data)), "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	dbf, err := Open("./testdata/ZRTBDQXFL.dbf", WithEncoding("gbk"), ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	for _, d := range []*DBF{reader, dbf} {
+		if err = d.Last(); err != nil {
+			t.Fatal(err)
+		}
+		if d.RecordCount() == 0 || d.StringValueByNameX("jyrq") == "" {
+			t.Errorf("unexpected empty record")
+		}
+		if err = d.Post(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Post in read-only mode = %v", err)
+		}
+		if err = d.Delete(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Delete in read-only mode = %v", err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	fields := []Field{
+		{Name: "CODE", Type: 'C', Length: 6},
+		{Name: "PRICE", Type: 'N', Length: 10, DecimalPlaces: 2},
+		{Name: "DAY", Type: 'D'},
+	}
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	write := func(out io.Writer, opts ...Option) error {
+		w, err := NewWriter(out, fields, "gbk", opts...)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			w.SetFieldValue("CODE", "60000"+strconv.Itoa(i))
+			w.SetDecimalValue("PRICE", decimal.NewFromFloat(1.5).Add(decimal.NewFromInt(int64(i))))
+			w.SetDateValue("DAY", day)
+			if err = w.Post(); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	}
+	check := func(name string, data []byte) {
+		dbf, err := NewReader(bytes.NewReader(data), int64(len(data)), "gbk")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer dbf.Close()
+		if dbf.RecordCount() != 3 {
+			t.Fatalf("%s: RecordCount = %d", name, dbf.RecordCount())
+		}
+		if err = dbf.Last(); err != nil {
+			t.Fatal(err)
+		}
+		if got := dbf.StringValueByNameX("CODE"); got != "600002" {
+			t.Errorf("%s: CODE = %q", name, got)
+		}
+		if got := dbf.FloatValueByNameX("PRICE"); got != 3.5 {
+			t.Errorf("%s: PRICE = %v", name, got)
+		}
+		if got := dbf.DateValueByNameX("DAY"); !got.Equal(day) {
+			t.Errorf("%s: DAY = %v", name, got)
+		}
+		if data[len(data)-1] != fileTerminator {
+			t.Errorf("%s: missing file terminator", name)
+		}
+	}
+
+	var buff bytes.Buffer
+	if err := write(&buff); err != nil {
+		t.Fatal(err)
+	}
+	check("buffer", buff.Bytes())
+
+	filename := filepath.Join(t.TempDir(), "writer.dbf")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("file", data)
+
+	// 预先声明记录数时，不能seek也直接写出去，不缓存在内存里
+	buff.Reset()
+	if err = write(&buff, WithRecordCount(3)); err != nil {
+		t.Fatal(err)
+	}
+	check("declared", buff.Bytes())
+	w, err := NewWriter(&buff, fields, "gbk", WithRecordCount(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.SetFieldValue("CODE", "600000")
+		err = w.Post()
+	}
+	if !errors.Is(err, record_count_mismatch) || w.pending.Len() != 0 {
+		t.Errorf("Post past declared count = %v, pending %d", err, w.pending.Len())
+	}
+	w, _ = NewWriter(&buff, fields, "gbk", WithRecordCount(2))
+	w.Post()
+	if err = w.Close(); !errors.Is(err, record_count_mismatch) {
+		t.Errorf("Close below declared count = %v", err)
+	}
+
+	for _, typ := range []byte{'M', 'W'} {
+		if _, err = NewWriter(&buff, []Field{{Name: "NOTE", Type: typ}}, "gbk"); err != memo_not_supported {
+			t.Errorf("NewWriter with %c field = %v", typ, err)
+		}
+	}
+}
+
+func TestDBF_Batch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "batch.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddStringField("STOCK_CODE", 6)
+	dbf.AddNumericField("QTY", 8, 0)
+	if err := dbf.BeginBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.BeginBatch(); err == nil {
+		t.Errorf("nested BeginBatch should fail")
+	}
+	for i := 0; i < 1000; i++ {
+		dbf.Append()
+		dbf.SetFieldValue("STOCK_CODE", "600570")
+		dbf.SetIntValue("QTY", i)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.Delete(); err == nil {
+		t.Errorf("Delete during batch should fail")
+	}
+	// 批量新增期间遍历记录，不能把内存里的记录数改回文件头里的记录数
+	count := 0
+	for _, err := range dbf.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != 1000 {
+		t.Errorf("Records during batch = %d, want 1000", count)
+	}
+	for i := 1000; i < 1010; i++ {
+		dbf.Append()
+		dbf.SetIntValue("QTY", i)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Commit(); err == nil {
+		t.Errorf("Commit without batch should fail")
+	}
+
+	// 回滚的记录不会写到文件里
+	if err := dbf.BeginBatch(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		dbf.Append()
+		dbf.SetIntValue("QTY", -1)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.RecordCount() != 1010 {
+		t.Fatalf("RecordCount = %d", dbf.RecordCount())
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := dbf.recordOffset(1011) + 1; info.Size() != want {
+		t.Errorf("file size = %d, want %d", info.Size(), want)
+	}
+	if err = dbf.Last(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.IntValueByNameX("QTY"); got != 1009 {
+		t.Errorf("QTY = %d", got)
+	}
+}
+
+func TestDBF_LastUpdate(t *testing.T) {
+	created := func() time.Time { return time.Date(2020, 5, 6, 10, 0, 0, 0, time.Local) }
+	modified := func() time.Time { return time.Date(2024, 2, 29, 10, 0, 0, 0, time.Local) }
+	day := func(now func() time.Time) time.Time {
+		y, m, d := now().Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	filename := filepath.Join(t.TempDir(), "update.dbf")
+	dbf := newTestFile(t, filename, "gbk", WithClock(created))
+	dbf.AddStringField("STOCK_CODE", 6)
+	if err := dbf.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.LastUpdate(); !got.Equal(day(created)) {
+		t.Errorf("LastUpdate after SaveNewFile = %v", got)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk", WithClock(modified))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if got := dbf.LastUpdate(); !got.Equal(day(created)) {
+		t.Errorf("LastUpdate after LoadFrom = %v", got)
+	}
+	dbf.Append()
+	dbf.SetFieldValue("STOCK_CODE", "600570")
+	if err = dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dbf.readHead(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.LastUpdate(); !got.Equal(day(modified)) {
+		t.Errorf("LastUpdate after Post = %v", got)
+	}
+
+	// 固定时钟生成的文件完全一致
+	fields := []Field{{Name: "STOCK_CODE", Type: 'C', Length: 6}}
+	var files [2]bytes.Buffer
+	for i := range files {
+		w, err := NewWriter(&files[i], fields, "gbk", WithClock(created))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetFieldValue("STOCK_CODE", "600570")
+		w.Post()
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(files[0].Bytes(), files[1].Bytes()) {
+		t.Errorf("files written with a fixed clock differ")
+	}
+}
+
+func TestDBF_Schema(t *testing.T) {
+	dbf, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.FileType() != 0x03 {
+		t.Errorf("FileType = %#x", dbf.FileType())
+	}
+	if int(dbf.HeaderSize()) != 32 + 32 * dbf.FieldsCount() + 1 {
+		t.Errorf("HeaderSize = %d", dbf.HeaderSize())
+	}
+	if got := dbf.LastUpdate(); got.Year() != 2021 {
+		t.Errorf("LastUpdate = %v", got)
+	}
+	offset := uint32(1)
+	for _, f := range dbf.Fields() {
+		if f.Offset != offset {
+			t.Errorf("field %s Offset = %d, want %d", f.Name, f.Offset, offset)
+		}
+		offset += uint32(f.Length)
+	}
+	if offset != uint32(dbf.RecordSize()) {
+		t.Errorf("RecordSize = %d, want %d", dbf.RecordSize(), offset)
+	}
+	if _, err = dbf.Field("NOT_EXISTS"); err == nil {
+		t.Errorf("Field of unknown name should fail")
+	}
+
+	filename := filepath.Join(t.TempDir(), "schema.dbf")
+	vfp := newTestFile(t, filename, "gbk")
+	vfp.AddStringField("NAME", 10)
+	vfp.AddIntegerField("ID")
+	defer vfp.Close()
+	if err = vfp.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := vfp.Field("ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Type != 'I' || id.Offset != 11 || id.Length != 4 {
+		t.Errorf("Field(ID) = %+v", id)
+	}
+	if vfp.FileType() != 0x30 || vfp.HeaderSize() != 32 + 2 * 32 + 1 + 263 {
+		t.Errorf("FileType = %#x, HeaderSize = %d", vfp.FileType(), vfp.HeaderSize())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dbf, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	report, err := Validate(dbf, dbf.Schema(), CheckRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("file does not match its own schema: %+v", report)
+	}
+
+	var schema Schema
+	spec := `{"fields": [
+		{"name": "jllx", "type": "C", "length": 1, "required": true, "pattern": "^[0-9]$"},
+		{"name": "qx", "type": "N", "length": 4},
+		{"name": "rrfl", "type": "N", "length": 9, "decimal_places": 4},
+		{"name": "jyrq", "type": "D", "length": 8, "required": true},
+		{"name": "bz", "type": "C", "length": 20}
+	]}`
+	if err = json.Unmarshal([]byte(spec), &schema); err != nil {
+		t.Fatal(err)
+	}
+	schema.Fields[0].Pattern = "^1$"
+	report, err = Validate(dbf, schema, CheckRecords(), MaxRecordErrors(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() {
+		t.Fatalf("report should not be valid")
+	}
+	if len(report.MissingFields) != 1 || report.MissingFields[0] != "bz" {
+		t.Errorf("MissingFields = %v", report.MissingFields)
+	}
+	if len(report.ExtraFields) != 3 {
+		t.Errorf("ExtraFields = %v", report.ExtraFields)
+	}
+	want := []FieldMismatch{
+		{Field: "rrfl", Property: "decimal_places", Expected: "4", Actual: "7"},
+		{Field: "jyrq", Property: "type", Expected: "D", Actual: "C"},
+	}
+	if len(report.Mismatches) != len(want) {
+		t.Fatalf("Mismatches = %+v", report.Mismatches)
+	}
+	for i := range want {
+		if report.Mismatches[i] != want[i] {
+			t.Errorf("Mismatches[%d] = %+v, want %+v", i, report.Mismatches[i], want[i])
+		}
+	}
+	if len(report.RecordErrors) != 5 || !report.Truncated {
+		t.Fatalf("RecordErrors = %v, Truncated = %v", report.RecordErrors, report.Truncated)
+	}
+	if rerr := report.RecordErrors[0]; rerr.RecordNo != 1 || rerr.Field != "jllx" || !errors.Is(rerr, ErrPatternMismatch) {
+		t.Errorf("RecordErrors[0] = %v", rerr)
+	}
+}
+
+func TestDBF_FieldNameCase(t *testing.T) {
+	dbf, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err = dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	want := dbf.StringValueByNameX("jyrq")
+	for _, name := range []string{"JYRQ", " Jyrq "} {
+		if got, err := dbf.StringValueByName(name); err != nil || got != want {
+			t.Errorf("StringValueByName(%q) = %q, %v", name, got, err)
+		}
+	}
+
+	strict, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk", ReadOnly(), CaseSensitiveFieldNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strict.Close()
+	if _, err = strict.StringValueByName("JYRQ"); err == nil {
+		t.Errorf("case sensitive lookup should fail")
+	}
+
+	filename := filepath.Join(t.TempDir(), "dup.dbf")
+	dup := newTestFile(t, filename, "gbk")
+	dup.AddStringField("CODE", 6)
+	dup.AddStringField("code", 6)
+	if dup.FieldsCount() != 1 {
+		t.Errorf("FieldsCount = %d", dup.FieldsCount())
+	}
+	if err = dup.AddField(Field{Name: "Code", Type: 'C', Length: 6}); err == nil {
+		t.Errorf("AddField with duplicate name should fail")
+	}
+	if err = dup.SaveNewFile(); err == nil {
+		t.Errorf("SaveNewFile with duplicate fields should fail")
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("file should not be created")
+	}
+}
+
+func TestDBF_FieldIndex(t *testing.T) {
+	dbf, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err = dbf.Last(); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := dbf.FieldIndex("JYRQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf.Fields()[idx].Name != "jyrq" {
+		t.Errorf("FieldIndex(JYRQ) = %d", idx)
+	}
+	if got := dbf.StringValueByNameX("jyrq"); dbf.StringValueX(idx) != got || string(dbf.RawValue(idx)) != got {
+		t.Errorf("StringValue = %q, RawValue = %q, want %q", dbf.StringValueX(idx), dbf.RawValue(idx), got)
+	}
+	qx, _ := dbf.FieldIndex("qx")
+	if got, err := dbf.IntValue(qx); err != nil || got != dbf.IntValueByNameX("qx") {
+		t.Errorf("IntValue = %d, %v", got, err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { _ = dbf.RawValue(idx) }); allocs != 0 {
+		t.Errorf("RawValue allocates %v times", allocs)
+	}
+	if _, err = dbf.StringValue(len(dbf.Fields())); err == nil {
+		t.Errorf("StringValue with index out of range should fail")
+	}
+	if dbf.RawValue(-1) != nil {
+		t.Errorf("RawValue with index out of range should be nil")
+	}
+	for rec, err := range dbf.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rec.StringValue(idx); v != rec.StringValueByNameX("jyrq") || string(rec.RawValue(idx)) != v {
+			t.Errorf("record %d StringValue = %q", rec.RecordNo(), v)
+		}
+		break
+	}
+
+	// VFP文件里隐藏的_NullFlags不占序号，和Fields()一致
+	vfp := newTestFile(t, filepath.Join(t.TempDir(), "nullable.dbf"), "gbk")
+	defer vfp.Close()
+	vfp.AddField(Field{Name: "CODE", Type: 'C', Length: 6, Nullable: true})
+	vfp.AddField(Field{Name: "QTY", Type: 'N', Length: 8, Nullable: true})
+	vfp.Append()
+	vfp.SetFieldValue("CODE", "600570")
+	vfp.SetNull("QTY")
+	if err = vfp.Post(); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range vfp.Fields() {
+		if got, err := vfp.FieldIndex(f.Name); err != nil || got != i {
+			t.Errorf("FieldIndex(%s) = %d, %v, want %d", f.Name, got, err, i)
+		}
+	}
+	if _, err = vfp.FieldIndex("_NullFlags"); err == nil {
+		t.Errorf("FieldIndex of hidden system field should fail")
+	}
+	if vfp.StringValueX(0) != "600570" || vfp.RawValue(len(vfp.Fields())) != nil {
+		t.Errorf("StringValue(0) = %q, RawValue(%d) = %q", vfp.StringValueX(0), len(vfp.Fields()), vfp.RawValue(len(vfp.Fields())))
+	}
+	ShowSystemFields()(vfp)
+	if idx, err := vfp.FieldIndex("_NullFlags"); err != nil || vfp.Fields()[idx].Name != "_NullFlags" {
+		t.Errorf("FieldIndex(_NullFlags) with system fields = %d, %v", idx, err)
+	}
+}
+
+func TestDBF_DetectEncoding(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "cp.dbf")
+	dbf := newTestFile(t, filename, "big5")
+	dbf.AddStringField("NAME", 10)
+	dbf.Append()
+	dbf.SetFieldValue("NAME", "中文")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.LanguageDriver() != 0x78 || dbf.CodePage() != 950 {
+		t.Errorf("LanguageDriver = %#x, CodePage = %d", dbf.LanguageDriver(), dbf.CodePage())
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.Encoding() != "Big5" || dbf.StringValueByNameX("NAME") != "中文" {
+		t.Errorf("Encoding = %q, NAME = %q", dbf.Encoding(), dbf.StringValueByNameX("NAME"))
+	}
+	dbf.Close()
+
+	// 默认不看.cpg文件，WithCPGFile时.cpg文件优先于语言驱动ID
+	if err = os.WriteFile(filepath.Join(dir, "cp.cpg"), []byte("ANSI 1252\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err = LoadFrom(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf.Encoding() != "Big5" {
+		t.Errorf("Encoding without WithCPGFile = %q", dbf.Encoding())
+	}
+	dbf.Close()
+	dbf, err = LoadFrom(filename, "", WithCPGFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.Encoding() != "windows-1252" {
+		t.Errorf("Encoding with .cpg = %q", dbf.Encoding())
+	}
+
+	// 没有语言驱动ID时使用默认编码
+	data, err := os.ReadFile("./testdata/ZRTBDQXFL.dbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Encoding() != defaultEncoding {
+		t.Errorf("Encoding without language driver = %q", reader.Encoding())
+	}
+
+	// 认识但是不支持的代码页（希腊语737）不能按默认编码读取
+	data[29] = 0x6A
+	if _, err = NewReader(bytes.NewReader(data), int64(len(data)), ""); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("unsupported code page = %v", err)
+	}
+	if _, err = NewReader(bytes.NewReader(data), int64(len(data)), "IBM437"); err != nil {
+		t.Errorf("explicit encoding = %v", err)
+	}
+}
+
+func newTestFile(tb testing.TB, filename string, encoding string, opts ...Option) *DBF {
+	tb.Helper()
+	dbf, err := NewFile(filename, encoding, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return dbf
+}
+
+func TestDBF_Encoding(t *testing.T) {
+	if _, err := NewFile(filepath.Join(t.TempDir(), "x.dbf"), "gbkk"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("NewFile with unknown encoding = %v", err)
+	}
+	if _, err := LoadFrom("./testdata/ZRTBDQXFL.dbf", "gbkk"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("LoadFrom with unknown encoding = %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "strict.dbf")
+	dbf := newTestFile(t, filename, "", WithTextEncoding(simplifiedchinese.GBK), StrictEncoding())
+	if dbf.Encoding() != "gbk" {
+		t.Errorf("Encoding = %q", dbf.Encoding())
+	}
+	dbf.AddStringField("NAME", 10)
+	dbf.Append()
+	if err := dbf.SetFieldValue("NAME", "中文"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.SetFieldValue("NAME", "😀"); !errors.Is(err, ErrUnencodableValue) {
+		t.Errorf("SetFieldValue with unencodable value = %v", err)
+	}
+	// 写入不完整的GBK字符
+	dbf.Append()
+	copy(dbf.recordBuff[1:], []byte{'A', 0xD6})
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk", StrictEncoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err = dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := dbf.StringValueByName("NAME"); err != nil || v != "中文" {
+		t.Errorf("NAME = %q, %v", v, err)
+	}
+	if err = dbf.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbf.StringValueByName("NAME")
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.RecordNo != 2 || decodeErr.Field != "NAME" || !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("StringValueByName with invalid bytes = %v", err)
+	}
+
+	lenient, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lenient.Close()
+	if err = lenient.Last(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := lenient.StringValueByName("NAME"); err != nil || v != "A�" {
+		t.Errorf("lenient NAME = %q, %v", v, err)
+	}
+}
+
+func TestSetFieldValue_TruncateMultibyte(t *testing.T) {
+	dbf := newTestFile(t, filepath.Join(t.TempDir(), "truncate_gbk.dbf"), "gbk", WithOverflowPolicy(OverflowTruncate))
+	dbf.AddStringField("NAME", 5)
+	dbf.Append()
+	// 每个汉字2字节，5字节只能放下2个汉字，剩下的1字节补空格
+	if err := dbf.SetFieldValue("NAME", "上海证券"); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.StringValueByNameX("NAME"); got != "上海" {
+		t.Errorf("NAME = %q", got)
+	}
+	if raw := fieldBytes(dbf.recordBuff, dbf.fieldsMap["NAME"]); raw[4] != space {
+		t.Errorf("NAME raw = %x", raw)
+	}
+
+	strict := newTestFile(t, filepath.Join(t.TempDir(), "truncate_strict.dbf"), "gbk", WithOverflowPolicy(OverflowTruncate), StrictEncoding())
+	strict.AddStringField("NAME", 5)
+	strict.Append()
+	if err := strict.SetFieldValue("NAME", "a上海证券"); !errors.Is(err, ErrValueTruncated) {
+		t.Errorf("SetFieldValue in strict mode = %v", err)
+	}
+	if got := strict.StringValueByNameX("NAME"); got != "a上海" {
+		t.Errorf("strict NAME = %q", got)
+	}
+}
+
+func TestDBF_NullFlags(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "null.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddStringField("NAME", 10)
+	if err := dbf.AddField(Field{Name: "PRICE", Type: 'N', Length: 10, DecimalPlaces: 2, Nullable: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.AddField(Field{Name: "MEMO", Type: 'C', Length: 10, Nullable: true}); err != nil {
+		t.Fatal(err)
+	}
+	dbf.AddDateField("BEGIN_DATE")
+	if dbf.FileType() != byte(foxPro) {
+		t.Errorf("FileType = %#x, want VFP", dbf.FileType())
+	}
+	dbf.Append()
+	dbf.SetFieldValue("NAME", "a")
+	if err := dbf.SetNull("PRICE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.SetNull("NAME"); err == nil {
+		t.Errorf("SetNull on a non-nullable field should fail")
+	}
+	dbf.SetFieldValue("MEMO", "")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Append()
+	dbf.SetFieldValue("NAME", "b")
+	dbf.SetNull("MEMO")
+	dbf.SetNull("PRICE")
+	dbf.SetFieldValue("PRICE", "1.5")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := LoadFrom(filename, "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if names := dbf.FieldNames(); !reflect.DeepEqual(names, []string{"NAME", "PRICE", "MEMO", "BEGIN_DATE"}) || dbf.FieldsCount() != 4 || len(dbf.Fields()) != 4 {
+		t.Errorf("FieldNames = %v, FieldsCount = %d", names, dbf.FieldsCount())
+	}
+	dbf.First()
+	if null, _ := dbf.IsNull("PRICE"); !null {
+		t.Errorf("record 1 PRICE should be NULL")
+	}
+	if null, _ := dbf.IsNull("MEMO"); null {
+		t.Errorf("record 1 MEMO should not be NULL")
+	}
+	if v, err := dbf.NullStringValueByName("MEMO"); err != nil || !v.Valid || v.String != "" {
+		t.Errorf("record 1 MEMO = %+v, %v", v, err)
+	}
+	if v, err := dbf.NullFloat64ValueByName("PRICE"); err != nil || v.Valid {
+		t.Errorf("record 1 PRICE = %+v, %v", v, err)
+	}
+	if v, err := dbf.NullTimeValueByName("BEGIN_DATE"); err != nil || v.Valid {
+		t.Errorf("record 1 BEGIN_DATE = %+v, %v", v, err)
+	}
+	dbf.Next()
+	if v, err := dbf.NullFloat64ValueByName("PRICE"); err != nil || !v.Valid || v.Float64 != 1.5 {
+		t.Errorf("record 2 PRICE = %+v, %v", v, err)
+	}
+	if v, err := dbf.NullStringValueByName("MEMO"); err != nil || v.Valid {
+		t.Errorf("record 2 MEMO = %+v, %v", v, err)
+	}
+
+	dbf, err = LoadFrom(filename, "gbk", ReadOnly(), ShowSystemFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	fields := dbf.Fields()
+	if len(fields) != 5 || fields[4].Name != "_NullFlags" || fields[4].Type != '0' || fields[4].Length != 1 {
+		t.Errorf("Fields = %+v", fields)
+	}
+	type row struct {
+		Name  string   `dbf:"NAME"`
+		Price *float64 `dbf:"PRICE"`
+		Memo  *string  `dbf:"MEMO"`
+	}
+	var rows []row
+	if err = dbf.ReadAll(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Price != nil || rows[1].Memo != nil || rows[1].Price == nil || *rows[1].Price != 1.5 {
+		t.Errorf("ReadAll = %+v", rows)
+	}
+}
+
+func TestDBF_Autoincrement(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "autoinc.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddAutoincrementField("ID", 100, 5)
+	dbf.AddStringField("NAME", 10)
+	if dbf.FileType() != byte(foxProAutoincrement) {
+		t.Errorf("FileType = %#x, want 0x31", dbf.FileType())
+	}
+	post := func(dbf *DBF, name string, want int) {
+		t.Helper()
+		dbf.Append()
+		dbf.SetFieldValue("NAME", name)
+		dbf.SetIntValue("ID", 1)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+		if id := dbf.IntValueByNameX("ID"); id != want {
+			t.Errorf("%s ID = %d, want %d", name, id, want)
+		}
+	}
+	post(dbf, "a", 100)
+	post(dbf, "b", 105)
+
+	// 另一个句柄新增时接着文件里的下一个值分配
+	other, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(other, "c", 110)
+	other.Close()
+	post(dbf, "d", 115)
+
+	if err = dbf.BeginBatch(); err != nil {
+		t.Fatal(err)
+	}
+	post(dbf, "e", 120)
+	if err = dbf.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.BeginBatch()
+	post(dbf, "e", 120)
+	post(dbf, "f", 125)
+	if err = dbf.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err = LoadFrom(filename, "gbk", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	field, _ := dbf.Field("ID")
+	if !field.Autoincrement || field.AutoincrementNext != 130 || field.AutoincrementStep != 5 || dbf.RecordCount() != 6 {
+		t.Errorf("Field(ID) = %+v, RecordCount = %d", field, dbf.RecordCount())
+	}
+	dbf.Last()
+	if id := dbf.IntValueByNameX("ID"); id != 125 {
+		t.Errorf("last ID = %d", id)
+	}
+
+	var buff bytes.Buffer
+	// 预先声明记录数时，文件头里的下一个值按记录数推算
+	for _, opts := range [][]Option{nil, {WithRecordCount(2)}} {
+		buff.Reset()
+		w, err := NewWriter(&buff, []Field{{Name: "ID", Type: 'I', Autoincrement: true}, {Name: "NAME", Type: 'C', Length: 10}}, "gbk", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Post()
+		w.Post()
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		dbf, err = NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()), "gbk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if field, _ = dbf.Field("ID"); field.AutoincrementNext != 3 {
+			t.Errorf("Writer AutoincrementNext = %d", field.AutoincrementNext)
+		}
+		if dbf.Last(); dbf.IntValueByNameX("ID") != 2 {
+			t.Errorf("Writer last ID = %d", dbf.IntValueByNameX("ID"))
+		}
+	}
+	if err = dbf.AddField(Field{Name: "X", Type: 'C', Autoincrement: true}); err == nil {
+		t.Errorf("autoincrement character field should fail")
+	}
+}
+
+func TestDBF_Varlength(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "varlength.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	if err := dbf.AddField(Field{Name: "NAME", Type: 'V', Length: 10, Nullable: true}); err != nil {
+		t.Fatal(err)
+	}
+	dbf.AddVarbinaryField("HASH", 4)
+	dbf.AddBlobField("DATA")
+	dbf.Append()
+	dbf.SetFieldValue("NAME", "中文 ")
+	dbf.SetFieldValue("HASH", "\x00\x01\x02\x03")
+	dbf.SetFieldValue("DATA", "\xff\xfe\x00")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Append()
+	dbf.SetFieldValue("NAME", "0123456789")
+	dbf.SetFieldValue("HASH", "\x01")
+	if err := dbf.SetFieldValue("NAME", "01234567890"); !errors.Is(err, ErrValueOverflow) {
+		t.Errorf("overflow = %v", err)
+	}
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Append()
+	dbf.SetNull("NAME")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := LoadFrom(filename, "gbk", ReadOnly(), ShowSystemFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if fields := dbf.Fields(); len(fields) != 4 || fields[3].Length != 1 || !fields[1].Binary {
+		t.Errorf("Fields = %+v", fields)
+	}
+	dbf.First()
+	if v, _ := dbf.StringValueByName("NAME"); v != "中文 " {
+		t.Errorf("record 1 NAME = %q", v)
+	}
+	if b, _ := dbf.BytesValueByName("NAME"); len(b) != 5 {
+		t.Errorf("record 1 NAME bytes = %x", b)
+	}
+	if b, _ := dbf.BytesValueByName("HASH"); !bytes.Equal(b, []byte{0, 1, 2, 3}) {
+		t.Errorf("record 1 HASH = %x", b)
+	}
+	if b, _ := dbf.BytesValueByName("DATA"); !bytes.Equal(b, []byte{0xff, 0xfe, 0}) {
+		t.Errorf("record 1 DATA = %x", b)
+	}
+	// 字符串读取的也是备注文件里的内容，不是块号
+	if v, _ := dbf.StringValueByName("DATA"); v != "\xff\xfe\x00" {
+		t.Errorf("record 1 DATA string = %q", v)
+	}
+	if idx, err := dbf.FieldIndex("DATA"); err != nil || dbf.StringValueX(idx) != "\xff\xfe\x00" {
+		t.Errorf("record 1 DATA by index = %q, %v", dbf.StringValueX(idx), err)
+	}
+	dbf.Next()
+	if v, _ := dbf.StringValueByName("NAME"); v != "0123456789" {
+		t.Errorf("record 2 NAME = %q", v)
+	}
+	if b, _ := dbf.BytesValueByName("HASH"); !bytes.Equal(b, []byte{1}) {
+		t.Errorf("record 2 HASH = %x", b)
+	}
+	if b, _ := dbf.BytesValueByName("DATA"); len(b) != 0 {
+		t.Errorf("record 2 DATA = %x", b)
+	}
+	dbf.Next()
+	if null, _ := dbf.IsNull("NAME"); !null {
+		t.Errorf("record 3 NAME should be NULL")
+	}
+	if b, err := dbf.BytesValueByName("NAME"); b != nil || err != nil {
+		t.Errorf("record 3 NAME = %x, %v", b, err)
+	}
+	if b, _ := dbf.BytesValueByName("HASH"); len(b) != 0 {
+		t.Errorf("record 3 HASH = %x", b)
+	}
+}
+
+func TestDBF_DBase7(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "level7.dbf")
+	dbf := newTestFile(t, filename, "windows-1252", DBaseLevel7())
+	dbf.AddAutoincrementField("ID", 10, 1)
+	dbf.AddStringField("CUSTOMER_NAME_LONG", 20)
+	dbf.AddIntegerField("QTY")
+	dbf.AddDoubleField("PRICE", 2)
+	dbf.AddDateTimeField("CREATED_AT")
+	dbf.AddMemoField("REMARK")
+	if err := dbf.AddField(Field{Name: "AMOUNT", Type: 'Y'}); err == nil {
+		t.Errorf("VFP field in a dBase 7 file should fail")
+	}
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	for i, price := range []float64{-1.5, 2.25} {
+		dbf.Append()
+		dbf.SetFieldValue("customer_name_long", "café")
+		dbf.SetIntValue("QTY", i - 1)
+		dbf.SetDecimalValue("PRICE", decimal.NewFromFloat(price))
+		dbf.SetDateValue("CREATED_AT", created)
+		dbf.SetFieldValue("REMARK", "note")
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Append()
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := LoadFrom(filename, "", ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.FileType() != 0x8C || dbf.LanguageDriverName() != "DBWINUS0" || dbf.Encoding() != "windows-1252" {
+		t.Errorf("FileType = %#x, LanguageDriverName = %q, Encoding = %q", dbf.FileType(), dbf.LanguageDriverName(), dbf.Encoding())
+	}
+	fields := dbf.Fields()
+	if len(fields) != 6 || fields[0].Type != '+' || !fields[0].Autoincrement || fields[0].AutoincrementNext != 13 ||
+		fields[1].Name != "CUSTOMER_NAME_LONG" || fields[3].Type != 'O' || fields[4].Type != '@' || fields[2].Offset != 25 {
+		t.Errorf("Fields = %+v", fields)
+	}
+	dbf.First()
+	if b := dbf.RawValue(2); !bytes.Equal(b, []byte{0x7F, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("QTY -1 is stored as %x", b)
+	}
+	first := dbf.RawValue(3)
+	first = append([]byte(nil), first...)
+	if v := dbf.IntValueByNameX("ID"); v != 10 {
+		t.Errorf("record 1 ID = %d", v)
+	}
+	if v := dbf.FloatValueByNameX("PRICE"); v != -1.5 {
+		t.Errorf("record 1 PRICE = %v", v)
+	}
+	if v := dbf.DateValueByNameX("CREATED_AT"); !v.Equal(created) {
+		t.Errorf("record 1 CREATED_AT = %v", v)
+	}
+	if v := dbf.StringValueByNameX("CUSTOMER_NAME_LONG"); v != "café" {
+		t.Errorf("record 1 CUSTOMER_NAME_LONG = %q", v)
+	}
+	if v := dbf.StringValueByNameX("REMARK"); v != "note" {
+		t.Errorf("record 1 REMARK = %q", v)
+	}
+	dbf.Next()
+	if v := dbf.IntValueByNameX("QTY"); v != 0 || dbf.FloatValueByNameX("PRICE") != 2.25 {
+		t.Errorf("record 2 QTY = %d, PRICE = %v", v, dbf.FloatValueByNameX("PRICE"))
+	}
+	if bytes.Compare(first, dbf.RawValue(3)) >= 0 {
+		t.Errorf("O values should sort bytewise, %x >= %x", first, dbf.RawValue(3))
+	}
+	dbf.Next()
+	if v, _ := dbf.NullInt64ValueByName("QTY"); v.Valid {
+		t.Errorf("record 3 QTY = %+v, want NULL", v)
+	}
+	if v, _ := dbf.NullTimeValueByName("CREATED_AT"); v.Valid {
+		t.Errorf("record 3 CREATED_AT = %+v, want NULL", v)
+	}
+	if v := dbf.IntValueByNameX("ID"); v != 12 {
+		t.Errorf("record 3 ID = %d", v)
+	}
+}
+
+func TestDBF_CorruptFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "corrupt.dbf")
+	dbf := newTestFile(t, filename, "gbk")
+	dbf.AddStringField("CODE", 6)
+	dbf.AddNumericField("PRICE", 10, 2)
+	for _, code := range []string{"000001", "000002", "000003"} {
+		dbf.Append()
+		dbf.SetFieldValue("CODE", code)
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Close()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func(data []byte, opts ...Option) (*DBF, error) {
+		return NewReader(bytes.NewReader(data), int64(len(data)), "gbk", opts...)
+	}
+	if dbf, err = open(data); err != nil || len(dbf.Warnings()) != 0 {
+		t.Fatalf("valid file: %v, warnings %v", err, dbf.Warnings())
+	}
+	modified := func(modify func(b []byte) []byte) []byte {
+		return modify(append([]byte(nil), data...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+		fields int
+		records uint32
+	}{
+		{"short header", data[:20], ErrTruncatedHeader, 0, 0},
+		{"bad terminator", modified(func(b []byte) []byte { b[32 + 2 * 32] = ' '; return b }), ErrBadTerminator, 2, 3},
+		{"record size", modified(func(b []byte) []byte { b[10] = 10; return b }), ErrInconsistentRecordSize, 2, 3},
+		{"record count", modified(func(b []byte) []byte { b[4] = 5; return b }), ErrRecordCountMismatch, 2, 3},
+		{"truncated record", data[:len(data) - 4], ErrTruncatedRecord, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := open(tt.data)
+			var corrupt *CorruptError
+			if !errors.Is(err, tt.want) || !errors.As(err, &corrupt) {
+				t.Fatalf("open = %v, want %v", err, tt.want)
+			}
+			if tt.want == ErrTruncatedHeader {
+				return
+			}
+			dbf, err := open(tt.data, Lenient())
+			if err != nil {
+				t.Fatalf("lenient open = %v", err)
+			}
+			if len(dbf.Warnings()) == 0 || dbf.FieldsCount() != tt.fields || dbf.RecordCount() != tt.records {
+				t.Errorf("warnings = %v, fields = %v, records = %d", dbf.Warnings(), dbf.FieldNames(), dbf.RecordCount())
+			}
+			for rec, err := range dbf.Records() {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rec.StringValueByNameX("CODE") == "" {
+					t.Errorf("record %d CODE is empty", rec.RecordNo())
+				}
+			}
+		})
+	}
+	// 非VFP文件字段描述里的位置不一致，默认模式下也能打开，按顺序计算的位置读取，只记警告
+	dbf, err = open(modified(func(b []byte) []byte { b[32 + 32 + 12] = 9; return b }))
+	if err != nil {
+		t.Fatalf("field offset: %v", err)
+	}
+	if w := dbf.Warnings(); len(w) != 1 || !errors.Is(w[0], ErrInconsistentRecordSize) || dbf.FieldsCount() != 2 {
+		t.Errorf("field offset: warnings = %v, fields = %v", w, dbf.FieldNames())
+	}
+	if err = dbf.Go(2); err != nil || dbf.StringValueByNameX("CODE") != "000002" {
+		t.Errorf("field offset: record 2 CODE = %q, %v", dbf.StringValueByNameX("CODE"), err)
+	}
+}
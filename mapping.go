@@ -0,0 +1,346 @@
+package godbf
+
+import (
+	"github.com/shopspring/decimal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	结构体映射，通过dbf标签指定字段名，可选指定字段类型、长度和小数位数（只在NewFileFromStruct时使用）
+	type Quote struct {
+		StockCode string          `dbf:"STOCK_CODE,C,20"`
+		Price     decimal.Decimal `dbf:"PRICE,N,12,2"`
+		BeginDate time.Time       `dbf:"BEGIN_DATE"`
+		EndDate   *time.Time      `dbf:"END_DATE"`  // 指针类型，空值映射成nil
+		Ignored   string          `dbf:"-"`
+	}
+	没有dbf标签的字段不做映射
+*/
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+)
+
+type structField struct {
+	index []int
+	name string
+	fieldType fieldType  //标签里没有指定类型时为0，按Go类型推导
+	length uint8
+	decimalPlaces uint8
+}
+
+var structFieldsCache sync.Map  // reflect.Type -> []structField
+
+func structFields(t reflect.Type) ([]structField, error) {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.([]structField), nil
+	}
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("dbf")
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := structField{index: sf.Index, name: strings.TrimSpace(parts[0])}
+		if field.name == "" {
+			return nil, invalid_struct_tag
+		}
+		if len(parts) > 1 {
+			if len(parts[1]) != 1 {
+				return nil, invalid_struct_tag
+			}
+			field.fieldType = fieldType(strings.ToUpper(parts[1])[0])
+		}
+		if len(parts) > 2 {
+			length, err := strconv.ParseUint(parts[2], 10, 8)
+			if err != nil {
+				return nil, invalid_struct_tag
+			}
+			field.length = uint8(length)
+		}
+		if len(parts) > 3 {
+			decimalPlaces, err := strconv.ParseUint(parts[3], 10, 8)
+			if err != nil {
+				return nil, invalid_struct_tag
+			}
+			field.decimalPlaces = uint8(decimalPlaces)
+		}
+		fields = append(fields, field)
+	}
+	structFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+// ScanRecord 把当前记录的值按dbf标签写到结构体里，dst必须是结构体指针
+func (dbf *DBF)ScanRecord(dst any) error {
+	return atRecord(dbf.currentRecordNo, dbf.scanInto(dbf.recordBuff, dst))
+}
+
+func (dbf *DBF)scanInto(buff []byte, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return struct_pointer_required
+	}
+	return dbf.scanStruct(buff, v.Elem())
+}
+
+func (dbf *DBF)scanStruct(buff []byte, v reflect.Value) error {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, sf := range fields {
+		field, ok := dbf.lookupField(sf.name)
+		if !ok {
+			return field_not_exists
+		}
+		if err = dbf.scanField(buff, field, v.FieldByIndex(sf.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dbf *DBF)scanField(buff []byte, field dbfField, v reflect.Value) error {
+	text, err := dbf.fieldString(buff, field)
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Pointer {
+		// 空值和NULL映射成nil
+		if text == "" || dbf.isNull(buff, field) {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	} else if text == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		t, err := dbf.fieldDate(buff, field)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case decimalType:
+		d, err := dbf.fieldDecimal(buff, field)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := dbf.fieldBool(buff, field)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		d, err := dbf.fieldDecimal(buff, field)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(d.IntPart()) {
+			return ErrValueOverflow
+		}
+		v.SetInt(d.IntPart())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		d, err := dbf.fieldDecimal(buff, field)
+		if err != nil {
+			return err
+		}
+		if d.IsNegative() || v.OverflowUint(uint64(d.IntPart())) {
+			return ErrValueOverflow
+		}
+		v.SetUint(uint64(d.IntPart()))
+	case reflect.Float32, reflect.Float64:
+		f, err := dbf.fieldFloat(buff, field)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return unsupported_struct_field_type
+	}
+	return nil
+}
+
+// AppendStruct 按dbf标签把结构体的值追加成一条新记录并提交
+func (dbf *DBF)AppendStruct(src any) error {
+	if err := dbf.appendStruct(src); err != nil {
+		return err
+	}
+	return dbf.Post()
+}
+
+// 新增一条记录并按dbf标签填好字段值，不提交
+func (dbf *DBF)appendStruct(src any) error {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return struct_pointer_required
+	}
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	dbf.Append()
+	for _, sf := range fields {
+		field, ok := dbf.lookupField(sf.name)
+		if !ok {
+			return field_not_exists
+		}
+		fv := v.FieldByIndex(sf.index)
+		if fv.Kind() == reflect.Pointer && fv.IsNil() && field.isNullable() {
+			// 可以为NULL的字段，nil写成NULL
+			if err = dbf.SetNull(field.name); err != nil {
+				return err
+			}
+			continue
+		}
+		text, err := formatStructField(field, fv)
+		if err != nil {
+			return err
+		}
+		if err = dbf.setField(field, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatStructField(field dbfField, v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	switch v.Type() {
+	case timeType:
+		return formatDate(field, v.Interface().(time.Time)), nil
+	case decimalType:
+		return formatDecimal(field, v.Interface().(decimal.Decimal)), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return formatBool(field, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return formatDecimal(field, decimal.NewFromInt(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return formatDecimal(field, decimal.RequireFromString(strconv.FormatUint(v.Uint(), 10))), nil
+	case reflect.Float32, reflect.Float64:
+		return formatDecimal(field, decimal.NewFromFloat(v.Float())), nil
+	}
+	return "", unsupported_struct_field_type
+}
+
+// ReadAll 把所有未删除的记录读到结构体切片里，dst必须是*[]T或者*[]*T，不会改变当前记录的位置
+func (dbf *DBF)ReadAll(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return slice_pointer_required
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPointer := elemType.Kind() == reflect.Pointer
+	if isPointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return slice_pointer_required
+	}
+	// 用Records遍历，不改变当前记录的位置
+	for rec, err := range dbf.Records(SkipDeleted()) {
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(elemType)
+		if err = dbf.scanStruct(rec.buff, elem.Elem()); err != nil {
+			return atRecord(rec.recordNo, err)
+		}
+		if isPointer {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	v.Elem().Set(slice)
+	return nil
+}
+
+// NewFileFromStruct 按结构体的dbf标签生成新文件的字段，标签里没有指定类型时按Go类型推导：
+// string->C(254)，bool->L，整数->N(20)，浮点数->N(20,6)，decimal.Decimal->N(20,4)，time.Time->D
+func NewFileFromStruct(filename string, encoding string, v any, opts ...Option) (*DBF, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, struct_pointer_required
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+	dbf, err := NewFile(filename, encoding, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, sf := range fields {
+		goType := t.FieldByIndex(sf.index).Type
+		if goType.Kind() == reflect.Pointer {
+			goType = goType.Elem()
+		}
+		if sf.fieldType == 0 {
+			sf.fieldType, sf.length, sf.decimalPlaces, err = defaultFieldType(goType)
+			if err != nil {
+				return nil, err
+			}
+		}
+		field := Field{Name: sf.name, Type: byte(sf.fieldType), Length: sf.length, DecimalPlaces: sf.decimalPlaces}
+		if err = dbf.AddField(field); err == unsupported_field_type {
+			return nil, invalid_struct_tag
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return dbf, nil
+}
+
+func defaultFieldType(t reflect.Type) (fieldType, uint8, uint8, error) {
+	switch t {
+	case timeType:
+		return fieldtype_date, 8, 0, nil
+	case decimalType:
+		return fieldtype_numeric, 20, 4, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return fieldtype_character, 254, 0, nil
+	case reflect.Bool:
+		return fieldtype_logical, 1, 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fieldtype_numeric, 20, 0, nil
+	case reflect.Float32, reflect.Float64:
+		return fieldtype_numeric, 20, 6, nil
+	}
+	return 0, 0, 0, unsupported_struct_field_type
+}
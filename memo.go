@@ -0,0 +1,347 @@
+package godbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+	备注文件(.DBT/.FPT)结构说明：
+	dBase III .DBT  文件头512位，第1-4位是下一个可用块号(小端)，块大小固定512，备注内容以0x1A 0x1A结束
+	dBase IV  .DBT  文件头512位，第1-4位是下一个可用块号(小端)，第21-22位是块大小，
+	                每个备注块前8位：0xFF 0xFF 0x08 0x00 + 备注长度(小端，包含这8位)
+	FoxPro    .FPT  文件头512位，第1-4位是下一个可用块号(大端)，第7-8位是块大小(大端)，
+	                每个备注块前8位：备注类型(大端) + 备注长度(大端，不包含这8位)
+*/
+
+type memoFormat uint8
+const (
+	memo_dbase3 memoFormat = iota
+	memo_dbase4
+	memo_foxpro
+)
+
+const memoHeaderSize = 512
+const dbase3MemoBlockSize = 512
+const foxproMemoBlockSize = 64
+const foxproMemoTypeBinary = 0  //图片和二进制内容
+const foxproMemoTypeText = 1
+
+type memoFile struct {
+	file *os.File
+	format memoFormat
+	blockSize uint32
+}
+
+// 根据DBF文件类型判断备注文件的格式
+func memoFormatOf(t fileType) memoFormat {
+	switch t {
+	case foxPro, foxProAutoincrement, foxPro2_Memo:
+		return memo_foxpro
+	case dbase_IV_Memo, dbase_IV_SQL_Table_Memo, dbase7_Memo:
+		return memo_dbase4
+	default:
+		return memo_dbase3
+	}
+}
+
+// 备注文件名，和DBF文件同名，扩展名大小写跟随DBF文件
+func memoFileName(filename string, format memoFormat) string {
+	ext := ".dbt"
+	if format == memo_foxpro {
+		ext = ".fpt"
+	}
+	dbfExt := filepath.Ext(filename)
+	if dbfExt != "" && strings.ToUpper(dbfExt) == dbfExt {
+		ext = strings.ToUpper(ext)
+	}
+	return strings.TrimSuffix(filename, dbfExt) + ext
+}
+
+func openMemoFile(filename string, format memoFormat, readOnly bool) (*memoFile, error) {
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	name := memoFileName(filename, format)
+	f, err := os.OpenFile(name, flag, 0666)
+	if os.IsNotExist(err) {
+		// 扩展名大小写不一致的情况，再试一次
+		alt := strings.TrimSuffix(name, filepath.Ext(name)) + strings.ToLower(filepath.Ext(name))
+		if alt == name {
+			alt = strings.TrimSuffix(name, filepath.Ext(name)) + strings.ToUpper(filepath.Ext(name))
+		}
+		f, err = os.OpenFile(alt, flag, 0666)
+	}
+	if err != nil {
+		return nil, err
+	}
+	memo := &memoFile{file: f, format: format}
+	header := make([]byte, memoHeaderSize)
+	if _, err = f.ReadAt(header, 0); err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	switch format {
+	case memo_foxpro:
+		memo.blockSize = uint32(binary.BigEndian.Uint16(header[6:8]))
+	case memo_dbase4:
+		memo.blockSize = uint32(binary.LittleEndian.Uint16(header[20:22]))
+		if memo.blockSize == 0 {
+			memo.blockSize = binary.LittleEndian.Uint32(header[4:8])
+		}
+	}
+	if memo.blockSize == 0 {
+		memo.blockSize = dbase3MemoBlockSize
+	}
+	return memo, nil
+}
+
+func createMemoFile(filename string, format memoFormat) (*memoFile, error) {
+	f, err := os.OpenFile(memoFileName(filename, format), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	memo := &memoFile{file: f, format: format, blockSize: dbase3MemoBlockSize}
+	header := make([]byte, memoHeaderSize)
+	switch format {
+	case memo_foxpro:
+		memo.blockSize = foxproMemoBlockSize
+		binary.BigEndian.PutUint32(header[0:4], memoHeaderSize / foxproMemoBlockSize)
+		binary.BigEndian.PutUint16(header[6:8], foxproMemoBlockSize)
+	case memo_dbase4:
+		binary.LittleEndian.PutUint32(header[0:4], 1)
+		// 第9-16位是DBF文件名(不含扩展名)
+		base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		copy(header[8:16], strings.ToUpper(base))
+		header[17] = 0x02
+		header[18] = 0x01
+		binary.LittleEndian.PutUint16(header[20:22], dbase3MemoBlockSize)
+	default:
+		binary.LittleEndian.PutUint32(header[0:4], 1)
+		header[16] = 0x03
+	}
+	if _, err = f.WriteAt(header, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return memo, nil
+}
+
+func (memo *memoFile) nextBlock() (uint32, error) {
+	buff := make([]byte, 4)
+	if _, err := memo.file.ReadAt(buff, 0); err != nil {
+		return 0, err
+	}
+	if memo.format == memo_foxpro {
+		return binary.BigEndian.Uint32(buff), nil
+	}
+	return binary.LittleEndian.Uint32(buff), nil
+}
+
+func (memo *memoFile) read(block uint32) ([]byte, error) {
+	if block == 0 {
+		return nil, nil
+	}
+	offset := int64(block) * int64(memo.blockSize)
+	switch memo.format {
+	case memo_foxpro:
+		head := make([]byte, 8)
+		if _, err := memo.file.ReadAt(head, offset); err != nil {
+			return nil, err
+		}
+		return memo.readBlock(offset + 8, binary.BigEndian.Uint32(head[4:8]))
+	case memo_dbase4:
+		head := make([]byte, 8)
+		if _, err := memo.file.ReadAt(head, offset); err != nil {
+			return nil, err
+		}
+		if bytes.Equal(head[0:4], []byte{0xFF, 0xFF, 0x08, 0x00}) {
+			size := binary.LittleEndian.Uint32(head[4:8])
+			if size < 8 {
+				return nil, nil
+			}
+			return memo.readBlock(offset + 8, size - 8)
+		}
+	}
+	// dBase III 格式，一直读到0x1A结束
+	var data []byte
+	chunk := make([]byte, memo.blockSize)
+	for {
+		n, err := memo.file.ReadAt(chunk, offset)
+		if i := bytes.IndexByte(chunk[:n], fileTerminator); i >= 0 {
+			return append(data, chunk[:i]...), nil
+		}
+		data = append(data, chunk[:n]...)
+		if err != nil {
+			if err == io.EOF {
+				return data, nil
+			}
+			return nil, err
+		}
+		offset += int64(n)
+	}
+}
+
+// 按块头里的长度读取备注内容，先和备注文件的长度比较，损坏的块头不会导致分配超大的内存
+func (memo *memoFile) readBlock(offset int64, size uint32) ([]byte, error) {
+	info, err := memo.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if int64(size) > info.Size() - offset {
+		return nil, &CorruptError{Err: ErrBadMemoBlock, Detail: "memo length " + strconv.FormatUint(uint64(size), 10) + " at " + strconv.FormatInt(offset, 10) + ", memo file size " + strconv.FormatInt(info.Size(), 10)}
+	}
+	data := make([]byte, size)
+	if _, err = memo.file.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 备注内容总是追加到文件尾部的新块，返回块号，memoType只用于FPT，调用方需要持有DBF的文件锁
+func (memo *memoFile) write(data []byte, memoType uint32) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	block, err := memo.nextBlock()
+	if err != nil {
+		return 0, err
+	}
+	var buff []byte
+	switch memo.format {
+	case memo_foxpro:
+		buff = make([]byte, 8, 8 + len(data))
+		binary.BigEndian.PutUint32(buff[0:4], memoType)
+		binary.BigEndian.PutUint32(buff[4:8], uint32(len(data)))
+		buff = append(buff, data...)
+	case memo_dbase4:
+		buff = make([]byte, 8, 8 + len(data))
+		copy(buff[0:4], []byte{0xFF, 0xFF, 0x08, 0x00})
+		binary.LittleEndian.PutUint32(buff[4:8], uint32(len(data) + 8))
+		buff = append(buff, data...)
+	default:
+		buff = append(append(make([]byte, 0, len(data) + 2), data...), fileTerminator, fileTerminator)
+	}
+	blocks := (uint32(len(buff)) + memo.blockSize - 1) / memo.blockSize
+	// 补齐到整块
+	buff = append(buff, make([]byte, int(blocks * memo.blockSize) - len(buff))...)
+	if _, err = memo.file.WriteAt(buff, int64(block) * int64(memo.blockSize)); err != nil {
+		return 0, err
+	}
+	next := make([]byte, 4)
+	if memo.format == memo_foxpro {
+		binary.BigEndian.PutUint32(next, block + blocks)
+	} else {
+		binary.LittleEndian.PutUint32(next, block + blocks)
+	}
+	_, err = memo.file.WriteAt(next, 0)
+	return block, err
+}
+
+func (memo *memoFile) close() error {
+	return memo.file.Close()
+}
+
+// 内容保存在备注文件里的字段，包括VFP9的blob字段
+func (f dbfField) isMemo() bool {
+	return f.fieldType == fieldtype_memo || f.fieldType == fieldtype_blob
+}
+
+// 读取记录中备注字段的块号，VFP是4位二进制整数，其余是10位数字字符串
+func memoBlock(buff []byte) uint32 {
+	if len(buff) == 4 {
+		return binary.LittleEndian.Uint32(buff)
+	}
+	block, _ := strconv.ParseUint(strings.TrimSpace(strings.Trim(bytes2str(buff), bytes2str([]byte{null}))), 10, 32)
+	return uint32(block)
+}
+
+func putMemoBlock(buff []byte, block uint32) {
+	if len(buff) == 4 {
+		binary.LittleEndian.PutUint32(buff, block)
+		return
+	}
+	copy(buff, bytes.Repeat([]byte{space}, len(buff)))
+	if block == 0 {
+		return
+	}
+	s := strconv.FormatUint(uint64(block), 10)
+	if len(s) <= len(buff) {
+		copy(buff[len(buff) - len(s):], s)
+	}
+}
+
+func (dbf *DBF)memoValue(buff []byte, field dbfField) (string, error) {
+	if dbf.memo == nil {
+		return "", memo_file_not_exists
+	}
+	data, err := dbf.memo.read(memoBlock(buff[field.displacement: field.displacement+uint32(field.length)]))
+	if err != nil {
+		return "", err
+	}
+	if field.isRaw() {
+		return string(data), nil
+	}
+	return dbf.decode(data, field.name)
+}
+
+func (dbf *DBF)setMemoValue(field dbfField, value string) error {
+	encoded := value
+	if !field.isRaw() {
+		var err error
+		if encoded, err = dbf.encode(value); err != nil {
+			return err
+		}
+	}
+	if dbf.memoBuff == nil {
+		dbf.memoBuff = make(map[string][]byte)
+	}
+	dbf.memoBuff[field.name] = []byte(encoded)
+	return nil
+}
+
+// 把待写入的备注内容写到备注文件，并把块号回填到记录里，调用方需要持有文件锁
+func (dbf *DBF)flushMemo() error {
+	if len(dbf.memoBuff) == 0 {
+		return nil
+	}
+	if dbf.memo == nil {
+		return memo_file_not_exists
+	}
+	for name, data := range dbf.memoBuff {
+		field := dbf.fieldsMap[name]
+		memoType := uint32(foxproMemoTypeText)
+		if field.isRaw() {
+			memoType = foxproMemoTypeBinary
+		}
+		block, err := dbf.memo.write(data, memoType)
+		if err != nil {
+			return err
+		}
+		putMemoBlock(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], block)
+	}
+	dbf.memoBuff = nil
+	return nil
+}
+
+// 清空备注文件，只保留文件头
+func (memo *memoFile) zap() error {
+	if err := memo.file.Truncate(memoHeaderSize); err != nil {
+		return err
+	}
+	next := make([]byte, 4)
+	blocks := (memoHeaderSize + memo.blockSize - 1) / memo.blockSize
+	if memo.format == memo_foxpro {
+		binary.BigEndian.PutUint32(next, blocks)
+	} else {
+		binary.LittleEndian.PutUint32(next, blocks)
+	}
+	_, err := memo.file.WriteAt(next, 0)
+	return err
+}
@@ -0,0 +1,320 @@
+package godbf
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+)
+
+/*
+	VFP的NULL值说明：
+	可以为NULL的字段，字段描述第19位的标志包含0x02，
+	每条记录的值是否为NULL记录在最后一个隐藏的系统字段_NullFlags里，类型是'0'，标志是0x05，
+	可以为NULL的字段按顺序从第0位开始各占一位，位为1表示NULL，字段长度是位数除以8向上取整，
+	VFP9的变长字段也在这里占位，见varlength.go
+*/
+
+const nullFlagsFieldName = "_NullFlags"
+
+func (f dbfField) isSystem() bool {
+	return f.flag & fieldflag_system != 0
+}
+
+func (f dbfField) isNullable() bool {
+	return f.flag & fieldflag_nullable != 0
+}
+
+// 按字段顺序分配_NullFlags里的位，变长字段先占变长位，可以为NULL时再占NULL位，同时更新fieldsMap
+func (dbf *DBF)assignNullBits() {
+	dbf.nullFlags = nil
+	bit := 0
+	for i := range dbf.fieldsList {
+		f := &dbf.fieldsList[i]
+		if f.fieldType == fieldtype_nullFlags {
+			nullFlags := *f
+			dbf.nullFlags = &nullFlags
+			dbf.fieldsMap[f.name] = *f
+			continue
+		}
+		if f.isVarlength() {
+			f.varlengthBit = bit
+			bit++
+		}
+		if f.isNullable() && !f.isSystem() {
+			f.nullBit = bit
+			bit++
+		}
+		dbf.fieldsMap[f.name] = *f
+	}
+}
+
+// 新建文件时维护_NullFlags字段，保证它是最后一个字段，长度够放下所有的位
+func (dbf *DBF)layoutNullFlags() {
+	bits := 0
+	index := -1
+	for i, f := range dbf.fieldsList {
+		if f.fieldType == fieldtype_nullFlags {
+			index = i
+			continue
+		}
+		if f.isVarlength() {
+			bits++
+		}
+		if f.isNullable() {
+			bits++
+		}
+	}
+	if bits == 0 {
+		return
+	}
+	nullFlags := dbfField{
+		name:      nullFlagsFieldName,
+		fieldType: fieldtype_nullFlags,
+		flag:      fieldflag_system | fieldflag_binary,
+		reserved:  make([]byte, 20),
+	}
+	if index >= 0 {
+		nullFlags = dbf.fieldsList[index]
+		dbf.fieldsList = append(dbf.fieldsList[:index], dbf.fieldsList[index+1:]...)
+	} else {
+		dbf.foldedNames[foldFieldName(nullFlagsFieldName)] = nullFlagsFieldName
+	}
+	nullFlags.length = uint8((bits + 7) / 8)
+	dbf.fieldsList = append(dbf.fieldsList, nullFlags)
+	dbf.fieldsCount = len(dbf.fieldsList)
+}
+
+// 按名称给字段加上标志，然后重新计算字段位置
+func (dbf *DBF)setFieldFlag(name string, flag byte) {
+	for i := range dbf.fieldsList {
+		if dbf.fieldsList[i].name == name {
+			dbf.fieldsList[i].flag |= flag
+		}
+	}
+	dbf.layoutFields()
+}
+
+func (dbf *DBF)isNullFlagSet(buff []byte, bit int) bool {
+	if dbf.nullFlags == nil {
+		return false
+	}
+	return buff[dbf.nullFlags.displacement + uint32(bit / 8)] & (1 << (bit % 8)) != 0
+}
+
+func (dbf *DBF)setNullFlag(bit int, value bool) {
+	if dbf.nullFlags == nil {
+		return
+	}
+	i := dbf.nullFlags.displacement + uint32(bit / 8)
+	if value {
+		dbf.recordBuff[i] |= 1 << (bit % 8)
+	} else {
+		dbf.recordBuff[i] &^= 1 << (bit % 8)
+	}
+}
+
+func (dbf *DBF)isNull(buff []byte, field dbfField) bool {
+	return field.isNullable() && dbf.isNullFlagSet(buff, field.nullBit)
+}
+
+func (dbf *DBF)setNullBit(field dbfField, null bool) {
+	if field.isNullable() {
+		dbf.setNullFlag(field.nullBit, null)
+	}
+}
+
+// IsNull 当前记录的字段是否为NULL，只有VFP里可以为NULL的字段才会是NULL
+func (dbf *DBF)IsNull(fieldname string) (bool, error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return false, field_not_exists
+	}
+	return dbf.isNull(dbf.recordBuff, field), nil
+}
+
+// SetNull 把当前记录的字段设置成NULL，字段内容清空，字段必须可以为NULL。
+// 之后再给字段赋值会清除NULL标记
+func (dbf *DBF)SetNull(fieldname string) error {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return field_not_exists
+	}
+	if !field.isNullable() || dbf.nullFlags == nil {
+		return field_not_nullable
+	}
+	b := fieldBytes(dbf.recordBuff, field)
+	switch {
+	case field.isMemo():
+		putMemoBlock(b, 0)
+	case field.isVarlength():
+		dbf.putVarlength(field, nil)
+	case field.isBinary():
+		copy(b, make([]byte, len(b)))
+	default:
+		copy(b, bytes.Repeat([]byte{space}, len(b)))
+	}
+	delete(dbf.memoBuff, field.name)
+	dbf.setNullBit(field, true)
+	return nil
+}
+
+func (r *Record)IsNull(fieldname string) (bool, error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return false, field_not_exists
+	}
+	return r.dbf.isNull(r.buff, field), nil
+}
+
+// Null*ValueByName 和sql.Null*一样用Valid表示是否为NULL，字符和备注以外的字段空白也当成NULL
+
+func (dbf *DBF)NullStringValueByName(fieldname string) (value sql.NullString, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = dbf.nullString(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)NullInt64ValueByName(fieldname string) (value sql.NullInt64, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = dbf.nullInt64(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)NullFloat64ValueByName(fieldname string) (value sql.NullFloat64, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = dbf.nullFloat64(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)NullBoolValueByName(fieldname string) (value sql.NullBool, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = dbf.nullBool(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (dbf *DBF)NullTimeValueByName(fieldname string) (value sql.NullTime, err error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = dbf.nullTime(dbf.recordBuff, field)
+	return value, atRecord(dbf.currentRecordNo, err)
+}
+
+func (r *Record)NullStringValueByName(fieldname string) (value sql.NullString, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = r.dbf.nullString(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)NullInt64ValueByName(fieldname string) (value sql.NullInt64, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = r.dbf.nullInt64(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)NullFloat64ValueByName(fieldname string) (value sql.NullFloat64, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = r.dbf.nullFloat64(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)NullBoolValueByName(fieldname string) (value sql.NullBool, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = r.dbf.nullBool(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)NullTimeValueByName(fieldname string) (value sql.NullTime, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return value, field_not_exists
+	}
+	value, err = r.dbf.nullTime(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+// 字段的文本值，valid为false表示NULL：_NullFlags里标记为NULL，或者字符和备注以外的字段是空白
+func (dbf *DBF)nullableString(buff []byte, field dbfField) (value string, valid bool, err error) {
+	if dbf.isNull(buff, field) {
+		return "", false, nil
+	}
+	value, err = dbf.fieldString(buff, field)
+	if err != nil {
+		return "", false, err
+	}
+	switch field.fieldType {
+	case fieldtype_character, fieldtype_memo, fieldtype_varchar, fieldtype_varbinary, fieldtype_blob:
+		return value, true, nil
+	case fieldtype_logical:
+		return value, value != "" && value != "?", nil
+	case fieldtype_date:
+		return value, strings.Trim(value, "0") != "", nil
+	}
+	return value, value != "", nil
+}
+
+func (dbf *DBF)nullString(buff []byte, field dbfField) (sql.NullString, error) {
+	value, valid, err := dbf.nullableString(buff, field)
+	return sql.NullString{String: value, Valid: valid}, err
+}
+
+func (dbf *DBF)nullInt64(buff []byte, field dbfField) (sql.NullInt64, error) {
+	_, valid, err := dbf.nullableString(buff, field)
+	if err != nil || !valid {
+		return sql.NullInt64{}, err
+	}
+	value, err := dbf.fieldInt(buff, field)
+	return sql.NullInt64{Int64: int64(value), Valid: err == nil}, err
+}
+
+func (dbf *DBF)nullFloat64(buff []byte, field dbfField) (sql.NullFloat64, error) {
+	_, valid, err := dbf.nullableString(buff, field)
+	if err != nil || !valid {
+		return sql.NullFloat64{}, err
+	}
+	value, err := dbf.fieldFloat(buff, field)
+	return sql.NullFloat64{Float64: value, Valid: err == nil}, err
+}
+
+func (dbf *DBF)nullBool(buff []byte, field dbfField) (sql.NullBool, error) {
+	_, valid, err := dbf.nullableString(buff, field)
+	if err != nil || !valid {
+		return sql.NullBool{}, err
+	}
+	value, err := dbf.fieldBool(buff, field)
+	return sql.NullBool{Bool: value, Valid: err == nil}, err
+}
+
+func (dbf *DBF)nullTime(buff []byte, field dbfField) (sql.NullTime, error) {
+	_, valid, err := dbf.nullableString(buff, field)
+	if err != nil || !valid {
+		return sql.NullTime{}, err
+	}
+	value, err := dbf.fieldDate(buff, field)
+	return sql.NullTime{Time: value, Valid: err == nil && !value.IsZero()}, err
+}
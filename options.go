@@ -0,0 +1,112 @@
+package godbf
+
+import (
+	"golang.org/x/text/encoding"
+	"time"
+)
+
+// Option 打开或新建文件时的可选配置
+type Option func(dbf *DBF)
+
+const defaultEncoding = "gbk"
+
+// WithEncoding 文件编码的名称，比如gbk、utf-8、windows-1252、IBM437，空字符串表示自动推断
+func WithEncoding(encoding string) Option {
+	return func(dbf *DBF) {
+		dbf.encoding = encoding
+	}
+}
+
+// WithTextEncoding 直接指定golang.org/x/text的编码，比如simplifiedchinese.GB18030，优先于编码名称
+func WithTextEncoding(e encoding.Encoding) Option {
+	return func(dbf *DBF) {
+		dbf.textEncoding = e
+	}
+}
+
+// StrictEncoding 读取到不符合编码的内容时返回DecodeError，写入编码不能表示的字符时返回ErrUnencodableValue，
+// 默认分别替换成U+FFFD和?
+func StrictEncoding() Option {
+	return func(dbf *DBF) {
+		dbf.strictEncoding = true
+	}
+}
+
+// ReadOnly 以只读模式打开，可以读取只读挂载目录里的文件，所有写操作返回ErrReadOnly
+func ReadOnly() Option {
+	return func(dbf *DBF) {
+		dbf.readOnly = true
+	}
+}
+
+// OverflowPolicy 写入的值超过字段长度时的处理方式
+type OverflowPolicy uint8
+const (
+	OverflowError OverflowPolicy = iota  // 返回ErrValueOverflow，默认方式
+	OverflowTruncate                      // 截断到字段长度，和旧版本的行为一致，字符字段按字符截断，StrictEncoding时返回ErrValueTruncated
+)
+
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(dbf *DBF) {
+		dbf.overflow = policy
+	}
+}
+
+// CaseSensitiveFieldNames 按字段名取值和赋值时区分大小写，默认和dBase一样不区分大小写，并且忽略字段名前后的空格
+func CaseSensitiveFieldNames() Option {
+	return func(dbf *DBF) {
+		dbf.caseSensitive = true
+	}
+}
+
+// DBaseLevel7 NewFile创建dBase 7格式的文件，字段名最长31位，整数、浮点数和日期时间字段使用dBase 7的类型
+func DBaseLevel7() Option {
+	return func(dbf *DBF) {
+		dbf.head.fileType = byte(dbase7)
+	}
+}
+
+// WithRecordCount NewWriter写到不能seek的io.Writer时预先声明记录数，文件头先写出去，记录直接写到w里，不再缓存在内存里。
+// Post超过声明的记录数，或者Close时记录数不够，都返回错误，这时已经写出去的内容不是完整的文件。对其它情况没有影响
+func WithRecordCount(n uint32) Option {
+	return func(dbf *DBF) {
+		dbf.recordCountHint = &n
+	}
+}
+
+// WithCPGFile 没有指定编码时，先按和DBF同名的.cpg文件推断编码（shapefile的工具都会写这个文件），没有.cpg文件时再看文件头的语言驱动。
+// 默认只按文件头推断
+func WithCPGFile() Option {
+	return func(dbf *DBF) {
+		dbf.useCPG = true
+	}
+}
+
+// Lenient 打开结构有问题的文件时尽量恢复，而不是返回CorruptError：
+// 字段位置按顺序重新计算，放不下的字段去掉，记录数改成文件里完整的记录条数，发现的问题可以通过Warnings查看。
+// 恢复出来的结构不一定对，建议和ReadOnly一起使用
+func Lenient() Option {
+	return func(dbf *DBF) {
+		dbf.lenient = true
+	}
+}
+
+// ShowSystemFields FieldNames、FieldsCount、Fields和FieldIndex里包括VFP的_NullFlags之类的系统字段，默认不包括
+func ShowSystemFields() Option {
+	return func(dbf *DBF) {
+		dbf.showSystemFields = true
+	}
+}
+
+// WithClock 写入时更新文件头修改日期用的时钟，默认time.Now，固定时钟可以生成完全一致的文件
+func WithClock(now func() time.Time) Option {
+	return func(dbf *DBF) {
+		dbf.clock = now
+	}
+}
+
+func (dbf *DBF)applyOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(dbf)
+	}
+}
@@ -0,0 +1,166 @@
+package godbf
+
+import (
+	"bufio"
+	"github.com/shopspring/decimal"
+	"io"
+	"iter"
+	"time"
+)
+
+// Record 一条记录的快照，读取之后不会再随文件变化
+type Record struct {
+	dbf *DBF
+	recordNo uint32
+	buff []byte
+}
+
+// RecordsOption Records遍历时的可选配置
+type RecordsOption func(cfg *recordsConfig)
+
+type recordsConfig struct {
+	skipDeleted bool
+}
+
+// SkipDeleted 遍历时跳过已删除的记录
+func SkipDeleted() RecordsOption {
+	return func(cfg *recordsConfig) {
+		cfg.skipDeleted = true
+	}
+}
+
+// Records 从第一条开始顺序遍历所有记录，不会改变当前记录的位置
+//
+//	for rec, err := range dbf.Records() {
+//		if err != nil {
+//			return err
+//		}
+//		_ = rec.StringValueByNameX("STOCK_CODE")
+//	}
+func (dbf *DBF)Records(opts ...RecordsOption) iter.Seq2[*Record, error] {
+	cfg := recordsConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(yield func(*Record, error) bool) {
+		// 先读一下文件头，有可能有新数据写进来
+		if err := dbf.readHead(); err != nil {
+			yield(nil, err)
+			return
+		}
+		size := int64(dbf.head.recordSize)
+		section := io.NewSectionReader(dbf.reader, int64(dbf.head.dataOffset), int64(dbf.head.recordCount) * size)
+		reader := bufio.NewReaderSize(section, 64 * int(size))
+		for recordNo := uint32(1); recordNo <= dbf.head.recordCount; recordNo++ {
+			buff := make([]byte, size)
+			if _, err := io.ReadFull(reader, buff); err != nil {
+				yield(nil, err)
+				return
+			}
+			if cfg.skipDeleted && buff[0] == deletedFlag {
+				continue
+			}
+			if !yield(&Record{dbf: dbf, recordNo: recordNo, buff: buff}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// RecordNo 记录号，从1开始
+func (r *Record)RecordNo() uint32 {
+	return r.recordNo
+}
+
+func (r *Record)IsDeleted() bool {
+	return r.buff[0] == deletedFlag
+}
+
+// Scan 按dbf标签把记录的值写到结构体里，dst必须是结构体指针
+func (r *Record)Scan(dst any) error {
+	return atRecord(r.recordNo, r.dbf.scanInto(r.buff, dst))
+}
+
+func (r *Record)StringValueByName(fieldname string) (value string, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return "", field_not_exists
+	}
+	value, err = r.dbf.fieldString(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)StringValueByNameX(fieldname string) (value string) {
+	value, _ = r.StringValueByName(fieldname)
+	return value
+}
+
+func (r *Record)IntValueByName(fieldname string) (value int, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return 0, field_not_exists
+	}
+	value, err = r.dbf.fieldInt(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)IntValueByNameX(fieldname string) (value int) {
+	value, _ = r.IntValueByName(fieldname)
+	return value
+}
+
+func (r *Record)FloatValueByName(fieldname string) (value float64, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return 0, field_not_exists
+	}
+	value, err = r.dbf.fieldFloat(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)FloatValueByNameX(fieldname string) (value float64) {
+	value, _ = r.FloatValueByName(fieldname)
+	return value
+}
+
+func (r *Record)DecimalValueByName(fieldname string) (value decimal.Decimal, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return decimal.Zero, field_not_exists
+	}
+	value, err = r.dbf.fieldDecimal(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)DecimalValueByNameX(fieldname string) (value decimal.Decimal) {
+	value, _ = r.DecimalValueByName(fieldname)
+	return value
+}
+
+func (r *Record)DateValueByName(fieldname string) (value time.Time, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return time.Time{}, field_not_exists
+	}
+	value, err = r.dbf.fieldDate(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)DateValueByNameX(fieldname string) (value time.Time) {
+	value, _ = r.DateValueByName(fieldname)
+	return value
+}
+
+func (r *Record)BoolValueByName(fieldname string) (value bool, err error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return false, field_not_exists
+	}
+	value, err = r.dbf.fieldBool(r.buff, field)
+	return value, atRecord(r.recordNo, err)
+}
+
+func (r *Record)BoolValueByNameX(fieldname string) (value bool) {
+	value, _ = r.BoolValueByName(fieldname)
+	return value
+}
@@ -0,0 +1,167 @@
+// Package sqldriver 基于godbf实现的database/sql驱动，一个目录就是一个数据库，目录下的每个.dbf文件就是一张表
+//
+//	import _ "github.com/san-pang/godbf/sqldriver"
+//
+//	db, err := sql.Open("dbf", "/data/exchange?encoding=gbk")
+//	rows, err := db.Query("SELECT zqdm, rrfl FROM ZRTBDQXFL WHERE jllx = ? ORDER BY zqdm LIMIT 10", "0")
+//
+// DSN是目录路径，可以通过encoding参数指定文件编码，默认gbk。
+// 驱动不支持事务，每条语句单独打开和关闭表文件，写入使用godbf的文件锁。
+// DELETE只做逻辑删除，查询时跳过已删除的记录。
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const defaultEncoding = "gbk"
+
+func init() {
+	sql.Register("dbf", &Driver{})
+}
+
+var errTxNotSupported = errors.New("sqldriver: transactions are not supported")
+
+// Driver 实现driver.Driver和driver.DriverContext
+type Driver struct{}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	dir, encoding, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: d, dir: dir, encoding: encoding}, nil
+}
+
+// DSN格式：目录路径[?encoding=编码]
+func parseDSN(dsn string) (dir string, encoding string, err error) {
+	dir, query, _ := strings.Cut(dsn, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", err
+	}
+	encoding = values.Get("encoding")
+	if encoding == "" {
+		encoding = defaultEncoding
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return "", "", errors.New("sqldriver: " + dir + " is not a directory")
+	}
+	return dir, encoding, nil
+}
+
+type connector struct {
+	driver *Driver
+	dir string
+	encoding string
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{dir: c.dir, encoding: c.encoding}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+type conn struct {
+	dir string
+	encoding string
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	parsed, numInput, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, parsed: parsed, numInput: numInput}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errTxNotSupported
+}
+
+type stmt struct {
+	conn *conn
+	parsed interface{}
+	numInput int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.numInput
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	switch parsed := s.parsed.(type) {
+	case *insertStmt:
+		return s.conn.execInsert(ctx, parsed, args)
+	case *updateStmt:
+		return s.conn.execUpdate(ctx, parsed, args)
+	case *deleteStmt:
+		return s.conn.execDelete(ctx, parsed, args)
+	}
+	return nil, errors.New("sqldriver: use Query for SELECT statements")
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	parsed, ok := s.parsed.(*selectStmt)
+	if !ok {
+		return nil, errors.New("sqldriver: use Exec for INSERT, UPDATE and DELETE statements")
+	}
+	return s.conn.execSelect(ctx, parsed, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type result struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
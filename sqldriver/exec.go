@@ -0,0 +1,636 @@
+package sqldriver
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/san-pang/godbf"
+	"github.com/shopspring/decimal"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 比较日期时支持的字符串格式
+var timeLayouts = []string{"20060102", "2006-01-02", "20060102150405", "2006-01-02 15:04:05", time.RFC3339}
+
+type table struct {
+	dbf *godbf.DBF
+	fields []godbf.Field
+}
+
+// 表名就是不带扩展名的文件名，不区分大小写
+func (c *conn) openTable(name string, opts ...godbf.Option) (*table, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(entry.Name(), name + ".dbf") {
+			continue
+		}
+		dbf, err := godbf.LoadFrom(filepath.Join(c.dir, entry.Name()), c.encoding, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &table{dbf: dbf, fields: dbf.Fields()}, nil
+	}
+	return nil, fmt.Errorf("sqldriver: table %s not found", name)
+}
+
+// 字段名不区分大小写
+func (t *table) field(name string) (godbf.Field, error) {
+	for _, f := range t.fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return godbf.Field{}, fmt.Errorf("sqldriver: column %s not found", name)
+}
+
+// 记录里字段的值，字符型字段空白返回空字符串，其余类型空白返回NULL
+func recordValue(rec *godbf.Record, f godbf.Field) (driver.Value, error) {
+	if null, err := rec.IsNull(f.Name); err != nil || null {
+		return nil, err
+	}
+	switch f.Type {
+	case 'Q', 'W':
+		return rec.BytesValueByName(f.Name)
+	}
+	s, err := rec.StringValueByName(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	switch f.Type {
+	case 'C', 'M', 'V':
+		return s, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	switch f.Type {
+	case 'N', 'F':
+		if f.DecimalPlaces == 0 {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return strconv.ParseFloat(s, 64)
+	case 'I', '+':
+		i, err := rec.IntValueByName(f.Name)
+		return int64(i), err
+	case 'B', 'Y', 'O':
+		return rec.FloatValueByName(f.Name)
+	case 'D', 'T', '@':
+		return rec.DateValueByName(f.Name)
+	case 'L':
+		if s == "?" {
+			return nil, nil
+		}
+		return rec.BoolValueByName(f.Name)
+	}
+	return s, nil
+}
+
+func setValue(dbf *godbf.DBF, f godbf.Field, value driver.Value) error {
+	switch v := value.(type) {
+	case nil:
+		if f.Nullable {
+			return dbf.SetNull(f.Name)
+		}
+		return dbf.SetFieldValue(f.Name, "")
+	case time.Time:
+		return dbf.SetDateValue(f.Name, v)
+	case bool:
+		return dbf.SetBoolValue(f.Name, v)
+	case int64:
+		return dbf.SetDecimalValue(f.Name, decimal.NewFromInt(v))
+	case float64:
+		return dbf.SetDecimalValue(f.Name, decimal.NewFromFloat(v))
+	case []byte:
+		return dbf.SetFieldValue(f.Name, string(v))
+	case string:
+		return dbf.SetFieldValue(f.Name, v)
+	}
+	return fmt.Errorf("sqldriver: unsupported value type %T", value)
+}
+
+type rowFunc func(column string) (driver.Value, error)
+
+func (t *table) rowOf(rec *godbf.Record) rowFunc {
+	return func(column string) (driver.Value, error) {
+		f, err := t.field(column)
+		if err != nil {
+			return nil, err
+		}
+		return recordValue(rec, f)
+	}
+}
+
+func noRow(column string) (driver.Value, error) {
+	return nil, fmt.Errorf("sqldriver: column %s can not be used here", column)
+}
+
+// 计算表达式的值，逻辑运算是三值逻辑，NULL参与比较时结果为NULL
+func eval(e expr, row rowFunc, args []driver.NamedValue) (driver.Value, error) {
+	switch e := e.(type) {
+	case *columnRef:
+		return row(e.name)
+	case *literal:
+		return e.value, nil
+	case *placeholder:
+		if e.index >= len(args) {
+			return nil, errors.New("sqldriver: not enough arguments")
+		}
+		return args[e.index].Value, nil
+	case *notExpr:
+		v, err := eval(e.expr, row, args)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("sqldriver: NOT requires a boolean operand")
+		}
+		return !b, nil
+	case *isNullExpr:
+		v, err := eval(e.expr, row, args)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.not, nil
+	case *inExpr:
+		v, err := eval(e.expr, row, args)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		for _, item := range e.list {
+			iv, err := eval(item, row, args)
+			if err != nil {
+				return nil, err
+			}
+			if c, ok := compare(v, iv); ok && c == 0 {
+				return !e.not, nil
+			}
+		}
+		return e.not, nil
+	case *binaryExpr:
+		left, err := eval(e.left, row, args)
+		if err != nil {
+			return nil, err
+		}
+		right, err := eval(e.right, row, args)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "AND", "OR":
+			return logical(e.op, left, right)
+		case "LIKE":
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			return like(toString(left), toString(right)), nil
+		}
+		c, ok := compare(left, right)
+		if !ok {
+			return nil, nil
+		}
+		switch e.op {
+		case "=":
+			return c == 0, nil
+		case "<>":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		}
+	}
+	return nil, fmt.Errorf("sqldriver: unsupported expression %T", e)
+}
+
+func logical(op string, left, right driver.Value) (driver.Value, error) {
+	l, lok := left.(bool)
+	r, rok := right.(bool)
+	if (left != nil && !lok) || (right != nil && !rok) {
+		return nil, fmt.Errorf("sqldriver: %s requires boolean operands", op)
+	}
+	if op == "AND" {
+		if (lok && !l) || (rok && !r) {
+			return false, nil
+		}
+		if lok && rok {
+			return true, nil
+		}
+		return nil, nil
+	}
+	if (lok && l) || (rok && r) {
+		return true, nil
+	}
+	if lok && rok {
+		return false, nil
+	}
+	return nil, nil
+}
+
+func like(s, pattern string) bool {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	matched, _ := regexp.MatchString(sb.String(), s)
+	return matched
+}
+
+func toString(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("20060102")
+	}
+	return fmt.Sprint(v)
+}
+
+func toFloat(v driver.Value) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toTime(v driver.Value) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func toBool(v driver.Value) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// 比较两个值，有NULL或者类型无法比较时返回false
+func compare(a, b driver.Value) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if _, ok := a.(time.Time); ok {
+		at, _ := toTime(a)
+		bt, ok := toTime(b)
+		return at.Compare(bt), ok
+	}
+	if _, ok := b.(time.Time); ok {
+		c, ok := compare(b, a)
+		return -c, ok
+	}
+	if _, ok := a.(bool); ok {
+		ab, _ := toBool(a)
+		bb, ok := toBool(b)
+		return compareBool(ab, bb), ok
+	}
+	if _, ok := b.(bool); ok {
+		c, ok := compare(b, a)
+		return -c, ok
+	}
+	as, aIsString := a.(string)
+	bs, bIsString := b.(string)
+	if aIsString && bIsString {
+		return strings.Compare(as, bs), true
+	}
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return cmp.Compare(af, bf), true
+	}
+	return strings.Compare(toString(a), toString(b)), true
+}
+
+func compareBool(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if a {
+		return 1
+	}
+	return -1
+}
+
+// 排序时NULL排在最前面
+func compareForSort(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compare(a, b)
+	return c
+}
+
+func matches(where expr, row rowFunc, args []driver.NamedValue) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	v, err := eval(where, row, args)
+	if err != nil {
+		return false, err
+	}
+	b, _ := v.(bool)
+	return b, nil
+}
+
+func (c *conn) execSelect(ctx context.Context, s *selectStmt, args []driver.NamedValue) (driver.Rows, error) {
+	// 查询只读打开，只读的目录和文件也能查询
+	t, err := c.openTable(s.table, godbf.ReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	defer t.dbf.Close()
+	columns := t.fields
+	if s.columns != nil {
+		columns = make([]godbf.Field, 0, len(s.columns))
+		for _, name := range s.columns {
+			f, err := t.field(name)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, f)
+		}
+	}
+	orderBy := make([]godbf.Field, 0, len(s.orderBy))
+	for _, item := range s.orderBy {
+		f, err := t.field(item.column)
+		if err != nil {
+			return nil, err
+		}
+		orderBy = append(orderBy, f)
+	}
+	type sortableRow struct {
+		values []driver.Value
+		keys []driver.Value
+	}
+	var result []sortableRow
+	for rec, err := range t.dbf.Records(godbf.SkipDeleted()) {
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		ok, err := matches(s.where, t.rowOf(rec), args)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		row := sortableRow{values: make([]driver.Value, len(columns)), keys: make([]driver.Value, len(orderBy))}
+		for i, f := range columns {
+			if row.values[i], err = recordValue(rec, f); err != nil {
+				return nil, err
+			}
+		}
+		for i, f := range orderBy {
+			if row.keys[i], err = recordValue(rec, f); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, row)
+	}
+	if len(orderBy) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for k, item := range s.orderBy {
+				c := compareForSort(result[i].keys[k], result[j].keys[k])
+				if c == 0 {
+					continue
+				}
+				if item.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if s.offset > 0 {
+		result = result[min(s.offset, len(result)):]
+	}
+	if s.limit >= 0 && s.limit < len(result) {
+		result = result[:s.limit]
+	}
+	data := make([][]driver.Value, len(result))
+	for i, row := range result {
+		data[i] = row.values
+	}
+	return &rows{fields: columns, data: data}, nil
+}
+
+func (c *conn) execInsert(ctx context.Context, s *insertStmt, args []driver.NamedValue) (driver.Result, error) {
+	t, err := c.openTable(s.table)
+	if err != nil {
+		return nil, err
+	}
+	defer t.dbf.Close()
+	columns := t.fields
+	if s.columns != nil {
+		columns = make([]godbf.Field, 0, len(s.columns))
+		for _, name := range s.columns {
+			f, err := t.field(name)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, f)
+		}
+	}
+	// 有自增字段时LastInsertId是最后分配的自增值，否则是最后一条记录的记录号
+	var autoincrement *godbf.Field
+	for i := range t.fields {
+		if t.fields[i].Autoincrement {
+			autoincrement = &t.fields[i]
+			break
+		}
+	}
+	var affected, lastInsertId int64
+	for _, row := range s.rows {
+		if len(row) != len(columns) {
+			return nil, errors.New("sqldriver: INSERT has mismatched number of columns and values")
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		t.dbf.Append()
+		for i, e := range row {
+			v, err := eval(e, noRow, args)
+			if err != nil {
+				return nil, err
+			}
+			if err = setValue(t.dbf, columns[i], v); err != nil {
+				return nil, err
+			}
+		}
+		if err = t.dbf.Post(); err != nil {
+			return nil, err
+		}
+		affected++
+		lastInsertId = int64(t.dbf.RecordCount())
+		if autoincrement != nil {
+			id, err := t.dbf.IntValueByName(autoincrement.Name)
+			if err != nil {
+				return nil, err
+			}
+			lastInsertId = int64(id)
+		}
+	}
+	return result{lastInsertId: lastInsertId, rowsAffected: affected}, nil
+}
+
+func (c *conn) execUpdate(ctx context.Context, s *updateStmt, args []driver.NamedValue) (driver.Result, error) {
+	t, err := c.openTable(s.table)
+	if err != nil {
+		return nil, err
+	}
+	defer t.dbf.Close()
+	sets := make([]godbf.Field, 0, len(s.sets))
+	for _, set := range s.sets {
+		f, err := t.field(set.column)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, f)
+	}
+	// 在一次加锁里先找出需要更新的记录和新的值，再逐条更新，中途其它进程不能修改文件
+	type change struct {
+		recordNo uint32
+		values []driver.Value
+	}
+	var changes []change
+	err = t.dbf.Locked(func() error {
+		for rec, err := range t.dbf.Records(godbf.SkipDeleted()) {
+			if err != nil {
+				return err
+			}
+			ok, err := matches(s.where, t.rowOf(rec), args)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			ch := change{recordNo: rec.RecordNo(), values: make([]driver.Value, len(sets))}
+			for i, set := range s.sets {
+				if ch.values[i], err = eval(set.value, t.rowOf(rec), args); err != nil {
+					return err
+				}
+			}
+			changes = append(changes, ch)
+		}
+		for _, ch := range changes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := t.dbf.Go(ch.recordNo); err != nil {
+				return err
+			}
+			for i, f := range sets {
+				if err := setValue(t.dbf, f, ch.values[i]); err != nil {
+					return err
+				}
+			}
+			if err := t.dbf.Post(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result{rowsAffected: int64(len(changes))}, nil
+}
+
+func (c *conn) execDelete(ctx context.Context, s *deleteStmt, args []driver.NamedValue) (driver.Result, error) {
+	t, err := c.openTable(s.table)
+	if err != nil {
+		return nil, err
+	}
+	defer t.dbf.Close()
+	var recordNos []uint32
+	// 和UPDATE一样在一次加锁里查找和删除，只做逻辑删除，和dBase的DELETE命令一致
+	err = t.dbf.Locked(func() error {
+		for rec, err := range t.dbf.Records(godbf.SkipDeleted()) {
+			if err != nil {
+				return err
+			}
+			ok, err := matches(s.where, t.rowOf(rec), args)
+			if err != nil {
+				return err
+			}
+			if ok {
+				recordNos = append(recordNos, rec.RecordNo())
+			}
+		}
+		for _, recordNo := range recordNos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := t.dbf.Go(recordNo); err != nil {
+				return err
+			}
+			if err := t.dbf.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result{rowsAffected: int64(len(recordNos))}, nil
+}
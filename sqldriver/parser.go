@@ -0,0 +1,619 @@
+package sqldriver
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+	支持的SQL语法：
+	SELECT * | col [, col ...] FROM table [WHERE expr] [ORDER BY col [ASC|DESC] [, ...]] [LIMIT n [OFFSET m]]
+	INSERT INTO table [(col [, col ...])] VALUES (value [, value ...]) [, (...)]
+	UPDATE table SET col = value [, col = value ...] [WHERE expr]
+	DELETE FROM table [WHERE expr]
+	expr支持 AND/OR/NOT、括号、= <> != < <= > >=、[NOT] LIKE、[NOT] IN (...)、IS [NOT] NULL，参数用?占位
+*/
+
+type tokenKind uint8
+const (
+	token_eof tokenKind = iota
+	token_ident
+	token_number
+	token_string
+	token_symbol
+	token_placeholder
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			// 字符串，两个单引号表示一个单引号
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, errors.New("sqldriver: unterminated string literal")
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: token_string, text: sb.String()})
+		case c == '"' || c == '`' || c == '[':
+			// 带引号的标识符
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(runes) && runes[j] != end {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, errors.New("sqldriver: unterminated quoted identifier")
+			}
+			tokens = append(tokens, token{kind: token_ident, text: string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: token_number, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{kind: token_ident, text: string(runes[i:j])})
+			i = j
+		case c == '?':
+			tokens = append(tokens, token{kind: token_placeholder, text: "?"})
+			i++
+		case c == '<' || c == '>' || c == '!':
+			if i+1 < len(runes) && (runes[i+1] == '=' || (c == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, token{kind: token_symbol, text: string(runes[i : i+2])})
+				i += 2
+				continue
+			}
+			if c == '!' {
+				return nil, fmt.Errorf("sqldriver: unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: token_symbol, text: string(c)})
+			i++
+		case strings.ContainsRune(",()*=;-+", c):
+			tokens = append(tokens, token{kind: token_symbol, text: string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("sqldriver: unexpected character %q", c)
+		}
+	}
+	return append(tokens, token{kind: token_eof}), nil
+}
+
+type expr interface{}
+
+type columnRef struct {
+	name string
+}
+
+type literal struct {
+	value driver.Value
+}
+
+type placeholder struct {
+	index int  //从0开始
+}
+
+type binaryExpr struct {
+	op string  //AND OR = <> < <= > >= LIKE
+	left, right expr
+}
+
+type notExpr struct {
+	expr expr
+}
+
+type isNullExpr struct {
+	expr expr
+	not bool
+}
+
+type inExpr struct {
+	expr expr
+	list []expr
+	not bool
+}
+
+type orderItem struct {
+	column string
+	desc bool
+}
+
+type assignment struct {
+	column string
+	value expr
+}
+
+type selectStmt struct {
+	table string
+	columns []string  //nil表示*
+	where expr
+	orderBy []orderItem
+	limit int  //-1表示不限制
+	offset int
+}
+
+type insertStmt struct {
+	table string
+	columns []string  //nil表示所有字段
+	rows [][]expr
+}
+
+type updateStmt struct {
+	table string
+	sets []assignment
+	where expr
+}
+
+type deleteStmt struct {
+	table string
+	where expr
+}
+
+type parser struct {
+	tokens []token
+	pos int
+	placeholders int
+}
+
+func parse(query string) (stmt interface{}, numInput int, err error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &parser{tokens: tokens}
+	switch {
+	case p.keyword("SELECT"):
+		stmt, err = p.parseSelect()
+	case p.keyword("INSERT"):
+		stmt, err = p.parseInsert()
+	case p.keyword("UPDATE"):
+		stmt, err = p.parseUpdate()
+	case p.keyword("DELETE"):
+		stmt, err = p.parseDelete()
+	default:
+		return nil, 0, p.unexpected()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	p.symbol(";")
+	if p.peek().kind != token_eof {
+		return nil, 0, p.unexpected()
+	}
+	return stmt, p.placeholders, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != token_eof {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == token_eof {
+		return errors.New("sqldriver: unexpected end of statement")
+	}
+	return fmt.Errorf("sqldriver: unexpected %q", t.text)
+}
+
+// 关键字不区分大小写，匹配成功时前进一个token
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == token_ident && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) symbol(s string) bool {
+	t := p.peek()
+	if t.kind == token_symbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != token_ident {
+		return "", p.unexpected()
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) identList() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.symbol(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	stmt := &selectStmt{limit: -1}
+	if !p.symbol("*") {
+		columns, err := p.identList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.columns = columns
+	}
+	var err error
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			var item orderItem
+			if item.column, err = p.ident(); err != nil {
+				return nil, err
+			}
+			if p.keyword("DESC") {
+				item.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			stmt.orderBy = append(stmt.orderBy, item)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if stmt.limit, err = p.integer(); err != nil {
+			return nil, err
+		}
+		if p.keyword("OFFSET") {
+			if stmt.offset, err = p.integer(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) integer() (int, error) {
+	t := p.peek()
+	if t.kind != token_number {
+		return 0, p.unexpected()
+	}
+	p.pos++
+	return strconv.Atoi(t.text)
+}
+
+func (p *parser) parseInsert() (*insertStmt, error) {
+	stmt := &insertStmt{}
+	var err error
+	if err = p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.symbol("(") {
+		if stmt.columns, err = p.identList(); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []expr
+		for {
+			value, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, value)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if stmt.columns != nil && len(row) != len(stmt.columns) {
+			return nil, errors.New("sqldriver: INSERT has mismatched number of columns and values")
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.symbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+func (p *parser) parseUpdate() (*updateStmt, error) {
+	stmt := &updateStmt{}
+	var err error
+	if stmt.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		var set assignment
+		if set.column, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		if set.value, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+		stmt.sets = append(stmt.sets, set)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	if p.keyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseDelete() (*deleteStmt, error) {
+	stmt := &deleteStmt{}
+	var err error
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.keyword("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: e}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	if p.symbol("(") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectSymbol(")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{expr: left, not: not}, nil
+	}
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("LIKE"):
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		var e expr = &binaryExpr{op: "LIKE", left: left, right: right}
+		if not {
+			e = &notExpr{expr: e}
+		}
+		return e, nil
+	case p.keyword("IN"):
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &inExpr{expr: left, not: not}
+		for {
+			value, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, value)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		return in, p.expectSymbol(")")
+	case not:
+		return nil, p.unexpected()
+	}
+	t := p.peek()
+	if t.kind == token_symbol {
+		switch t.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			op := t.text
+			if op == "!=" {
+				op = "<>"
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case token_placeholder:
+		p.pos++
+		p.placeholders++
+		return &placeholder{index: p.placeholders - 1}, nil
+	case token_string:
+		p.pos++
+		return &literal{value: t.text}, nil
+	case token_number:
+		p.pos++
+		return numberLiteral(t.text, false)
+	case token_symbol:
+		if t.text == "-" || t.text == "+" {
+			p.pos++
+			n := p.peek()
+			if n.kind != token_number {
+				return nil, p.unexpected()
+			}
+			p.pos++
+			return numberLiteral(n.text, t.text == "-")
+		}
+	case token_ident:
+		p.pos++
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return &literal{value: nil}, nil
+		case "TRUE":
+			return &literal{value: true}, nil
+		case "FALSE":
+			return &literal{value: false}, nil
+		}
+		return &columnRef{name: t.text}, nil
+	}
+	return nil, p.unexpected()
+}
+
+func numberLiteral(text string, negative bool) (expr, error) {
+	if negative {
+		text = "-" + text
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return &literal{value: i}, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("sqldriver: invalid number %q", text)
+	}
+	return &literal{value: f}, nil
+}
@@ -0,0 +1,129 @@
+package sqldriver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/san-pang/godbf"
+	"io"
+	"reflect"
+)
+
+// rows 查询结果，实现driver.Rows和driver.RowsColumnType*系列接口
+type rows struct {
+	fields []godbf.Field
+	data [][]driver.Value
+	pos int
+}
+
+func (r *rows) Columns() []string {
+	columns := make([]string, len(r.fields))
+	for i, f := range r.fields {
+		columns[i] = f.Name
+	}
+	return columns
+}
+
+func (r *rows) Close() error {
+	r.data = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.pos])
+	r.pos++
+	return nil
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	switch r.fields[index].Type {
+	case 'C':
+		return "CHARACTER"
+	case 'N':
+		return "NUMERIC"
+	case 'F':
+		return "FLOAT"
+	case 'L':
+		return "LOGICAL"
+	case 'D':
+		return "DATE"
+	case 'M':
+		return "MEMO"
+	case 'I':
+		return "INTEGER"
+	case 'B':
+		return "DOUBLE"
+	case 'Y':
+		return "CURRENCY"
+	case 'T':
+		return "DATETIME"
+	case 'V':
+		return "VARCHAR"
+	case 'Q':
+		return "VARBINARY"
+	case 'W':
+		return "BLOB"
+	case '@':
+		return "TIMESTAMP"
+	case '+':
+		return "AUTOINCREMENT"
+	case 'O':
+		return "DOUBLE"
+	}
+	return string(rune(r.fields[index].Type))
+}
+
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	f := r.fields[index]
+	switch f.Type {
+	case 'C', 'V', 'Q':
+		return int64(f.Length), true
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	f := r.fields[index]
+	switch f.Type {
+	case 'N', 'F':
+		return int64(f.Length), int64(f.DecimalPlaces), true
+	case 'Y':
+		return 19, 4, true
+	}
+	return 0, 0, false
+}
+
+// 字符型字段空白是空字符串，其余类型空白是NULL
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	switch r.fields[index].Type {
+	case 'C', 'M', 'V', 'Q', 'W':
+		return r.fields[index].Nullable, true
+	}
+	return true, true
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	f := r.fields[index]
+	switch f.Type {
+	case 'C', 'M', 'V':
+		return reflect.TypeOf("")
+	case 'Q', 'W':
+		return reflect.TypeOf([]byte(nil))
+	case 'N', 'F':
+		if f.DecimalPlaces == 0 {
+			return reflect.TypeOf(sql.NullInt64{})
+		}
+		return reflect.TypeOf(sql.NullFloat64{})
+	case 'I', '+':
+		return reflect.TypeOf(sql.NullInt64{})
+	case 'B', 'Y', 'O':
+		return reflect.TypeOf(sql.NullFloat64{})
+	case 'D', 'T', '@':
+		return reflect.TypeOf(sql.NullTime{})
+	case 'L':
+		return reflect.TypeOf(sql.NullBool{})
+	}
+	return reflect.TypeOf(sql.NullString{})
+}
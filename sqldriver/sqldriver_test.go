@@ -0,0 +1,105 @@
+package sqldriver
+
+import (
+	"database/sql"
+	"github.com/san-pang/godbf"
+	"testing"
+)
+
+func TestDriver(t *testing.T) {
+	dir := t.TempDir()
+	dbf, err := godbf.NewFile(dir + "/QUOTE.DBF", "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf.AddStringField("STOCK_CODE", 6)
+	dbf.AddNumericField("PRICE", 12, 2)
+	dbf.AddDateField("BEGIN_DATE")
+	if err = dbf.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	db, err := sql.Open("dbf", dir + "?encoding=gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	res, err := db.Exec("INSERT INTO quote (stock_code, price, begin_date) VALUES ('600570', 12.34, '20201213'), ('000002', ?, ?), ('600000', 8.5, NULL)", 22.2, "20210605")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("unexpected rows affected %d", n)
+	}
+	if _, err = db.Exec("UPDATE quote SET price = 9 WHERE stock_code = '600000'"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT stock_code, price FROM quote WHERE price > ? AND begin_date IS NOT NULL ORDER BY price DESC LIMIT 1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, _ := rows.ColumnTypes()
+	if types[1].DatabaseTypeName() != "NUMERIC" {
+		t.Errorf("unexpected database type %s", types[1].DatabaseTypeName())
+	}
+	if precision, scale, ok := types[1].DecimalSize(); !ok || precision != 12 || scale != 2 {
+		t.Errorf("unexpected decimal size %d, %d", precision, scale)
+	}
+	var codes []string
+	for rows.Next() {
+		var code string
+		var price float64
+		if err = rows.Scan(&code, &price); err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) != 1 || codes[0] != "000002" {
+		t.Errorf("unexpected result %v", codes)
+	}
+
+	var price float64
+	if err = db.QueryRow("SELECT price FROM quote WHERE stock_code LIKE '6000%'").Scan(&price); err != nil || price != 9 {
+		t.Errorf("unexpected updated price %v, %v", price, err)
+	}
+
+	// WHERE出错时在加锁的查找阶段就返回，不会删除任何记录
+	if _, err = db.Exec("DELETE FROM quote WHERE no_such_column = 1"); err == nil {
+		t.Errorf("DELETE with unknown column should fail")
+	}
+	all, err := db.Query("SELECT stock_code FROM quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	for all.Next() {
+		count++
+	}
+	all.Close()
+	if count != 3 {
+		t.Errorf("failed DELETE left %d records", count)
+	}
+	if _, err = db.Exec("DELETE FROM quote WHERE stock_code IN ('600570', '000002')"); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.QueryRow("SELECT stock_code FROM quote WHERE stock_code = '600570'").Scan(new(string)); err != sql.ErrNoRows {
+		t.Errorf("deleted record still returned: %v", err)
+	}
+	remaining, err := db.Query("SELECT stock_code FROM quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remaining.Close()
+	codes = nil
+	for remaining.Next() {
+		var code string
+		remaining.Scan(&code)
+		codes = append(codes, code)
+	}
+	if len(codes) != 1 || codes[0] != "600000" {
+		t.Errorf("unexpected records %v after delete", codes)
+	}
+}
@@ -13,12 +13,14 @@ type fileType uint8
 const (
 	foxBASE fileType = 0x02               //0x02    FoxBASE
 	foxBASE_III_NoMemo fileType = 0x03    //0x03    FoxBASE+/Dbase III plus, no memo
+	dbase7 fileType = 0x04                //0x04    dBase 7, no memo
 	foxPro fileType = 0x30                //0x30    Visual FoxPro
 	foxProAutoincrement fileType = 0x31   //0x31    Visual FoxPro,  enabled autoincrement
 	dbase_IV_SQL_Table_NoMemo fileType = 0x43      //0x43    dBASE IV SQL table files, no memo
 	dbase_IV_SQL_System_NoMemo fileType = 0x63     //0x63    dBASE IV SQL system files, no memo
 	foxBASE_III_Memo fileType = 0x83               //0x83    FoxBASE+/dBASE III PLUS, with memo
 	dbase_IV_Memo fileType = 0x8B                  //0x8B    dBASE IV with memo
+	dbase7_Memo fileType = 0x8C                    //0x8C    dBase 7 with memo
 	dbase_IV_SQL_Table_Memo fileType = 0xCB        //0xCB    dBASE IV SQL table files, with memo
 	foxPro2_Memo fileType = 0xF5                   //0xF5    FoxPro 2.x (or earlier) with memo
 	foxBASE2 fileType = 0xFB                       //0xFB    FoxBASE
@@ -31,13 +33,20 @@ const (
 	fieldtype_date      fieldType = 'D'
 	fieldtype_numeric   fieldType = 'N'  // 数值，包括整数和浮点小数
 	fieldtype_float     fieldType = 'F'
+	fieldtype_memo      fieldType = 'M'  // 备注，内容保存在.DBT/.FPT文件里，记录里只保存块号
+	fieldtype_integer   fieldType = 'I'  // VFP，4位小端整数
+	fieldtype_double    fieldType = 'B'  // VFP，8位IEEE双精度浮点数
+	fieldtype_currency  fieldType = 'Y'  // VFP，8位小端整数，实际值放大了10000倍
+	fieldtype_dateTime  fieldType = 'T'  // VFP，前4位是儒略日，后4位是当天的毫秒数
+	fieldtype_nullFlags fieldType = '0'  // VFP，隐藏的_NullFlags系统字段，每个可以为NULL的字段占一位
+	fieldtype_varchar   fieldType = 'V'  // VFP9，变长字符，实际长度见_NullFlags的变长位
+	fieldtype_varbinary fieldType = 'Q'  // VFP9，变长二进制
+	fieldtype_blob      fieldType = 'W'  // VFP9，二进制大对象，和备注一样保存在.FPT文件里
+	fieldtype_timestamp fieldType = '@'  // dBase 7，日期时间，见dbase7.go
+	fieldtype_autoincrement fieldType = '+'  // dBase 7，自增整数
+	fieldtype_double7   fieldType = 'O'  // dBase 7，8位双精度浮点数
 	/*
 		暂不支持
-		fieldtype_dateTime  fieldType = "T"
-		fieldtype_currency  fieldType = "Y"
-		fieldtype_double    fieldType = "B"
-		fieldtype_integer   fieldType = "I"
-		fieldtype_memo   	fieldType = "M"
 		fieldtype_general   fieldType = "G"
 		fieldtype_picture   fieldType = "P"
 	*/
@@ -48,6 +57,7 @@ const deletedFlag byte = 0x2A  //记录删除标记
 const space byte = 0x20  //空格
 const null byte = 0x00  //null
 const fileTerminator = 0x1A  //文件的结束符号
+const backlinkSize = 263  //VFP文件头结束符之后的backlink区域长度
 
 type dbfHeader struct {
 	fileType uint8  //第1位，文件类型
@@ -70,4 +80,6 @@ type dbfField struct {
 	autoincrementNext uint32  //第20-23位，自增字段的下一个值
 	autoincrementStep uint8  //第24位，自增步长
 	reserved    []byte  //第25-32位，reserve数据
+	nullBit int  //可以为NULL的字段在_NullFlags里的位
+	varlengthBit int  //变长字段在_NullFlags里的位
 }
@@ -0,0 +1,203 @@
+package godbf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Schema 接口规范里约定的文件结构，可以直接在代码里声明，也可以用encoding/json或yaml解析出来
+//
+//	fields:
+//	  - {name: ZQDM, type: C, length: 6, required: true, pattern: "^[0-9]{6}$"}
+//	  - {name: RRFL, type: N, length: 10, decimal_places: 4}
+type Schema struct {
+	Fields []SchemaField `json:"fields" yaml:"fields"`
+	AllowExtraFields bool `json:"allow_extra_fields,omitempty" yaml:"allow_extra_fields,omitempty"`  //文件里有规范之外的字段时不报错
+}
+
+// SchemaField 规范里的一个字段，Type为空时不检查类型，Length为0时不检查长度和小数位数
+type SchemaField struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`  //字段类型，C/N/F/L/D/M/I/B/Y/T
+	Length uint8 `json:"length,omitempty" yaml:"length,omitempty"`
+	DecimalPlaces uint8 `json:"decimal_places,omitempty" yaml:"decimal_places,omitempty"`
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`  //检查记录时值不能为空
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`  //检查记录时值必须匹配的正则表达式，空值不检查
+}
+
+// Schema 按文件现有的结构生成Schema，可以保存下来作为以后校验的依据，不包括系统字段
+func (dbf *DBF)Schema() Schema {
+	schema := Schema{Fields: make([]SchemaField, 0, len(dbf.fieldsList))}
+	for _, f := range dbf.fieldsList {
+		if f.isSystem() {
+			continue
+		}
+		schema.Fields = append(schema.Fields, SchemaField{
+			Name:          f.name,
+			Type:          string(rune(f.fieldType)),
+			Length:        f.length,
+			DecimalPlaces: f.decimalPlaces,
+		})
+	}
+	return schema
+}
+
+// ValidationReport 校验的结果，Valid为false时各个列表里是具体的问题
+type ValidationReport struct {
+	MissingFields []string  //规范里有，文件里没有的字段
+	ExtraFields []string  //文件里有，规范里没有的字段
+	Mismatches []FieldMismatch
+	RecordErrors []RecordError
+	Truncated bool  //记录错误超过了MaxRecordErrors，后面的记录没有再检查
+}
+
+// Valid 没有发现任何问题
+func (r *ValidationReport) Valid() bool {
+	return len(r.MissingFields) == 0 && len(r.ExtraFields) == 0 && len(r.Mismatches) == 0 && len(r.RecordErrors) == 0
+}
+
+// FieldMismatch 字段的定义和规范不一致，Property是type、length或者decimal_places
+type FieldMismatch struct {
+	Field string
+	Property string
+	Expected string
+	Actual string
+}
+
+// RecordError 记录的值不符合字段类型或者规范，Err可以用errors.Is判断，比如ErrInvalidNumeric、ErrValueRequired
+type RecordError struct {
+	RecordNo uint32
+	Field string
+	Value string
+	Err error
+}
+
+func (e RecordError) Error() string {
+	return "record " + strconv.FormatUint(uint64(e.RecordNo), 10) + " field " + e.Field + " value " + strconv.Quote(e.Value) + ": " + e.Err.Error()
+}
+
+func (e RecordError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateOption Validate的可选配置
+type ValidateOption func(cfg *validateConfig)
+
+type validateConfig struct {
+	checkRecords bool
+	maxRecordErrors int
+}
+
+// CheckRecords 除了字段定义，还逐条检查记录的值，已删除的记录不检查
+func CheckRecords() ValidateOption {
+	return func(cfg *validateConfig) {
+		cfg.checkRecords = true
+	}
+}
+
+// MaxRecordErrors 记录错误达到n个之后停止检查，默认100，0表示不限制
+func MaxRecordErrors(n int) ValidateOption {
+	return func(cfg *validateConfig) {
+		cfg.maxRecordErrors = n
+	}
+}
+
+// Validate 按规范校验文件结构，发现的问题全部放到报告里，只有读取文件出错或者规范本身有问题时才返回error
+func Validate(dbf *DBF, schema Schema, opts ...ValidateOption) (*ValidationReport, error) {
+	cfg := validateConfig{maxRecordErrors: 100}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	report := &ValidationReport{}
+	type check struct {
+		field dbfField
+		spec SchemaField
+		pattern *regexp.Regexp
+	}
+	var checks []check
+	expected := make(map[string]bool, len(schema.Fields))
+	for _, spec := range schema.Fields {
+		field, ok := dbf.lookupField(spec.Name)
+		if !ok {
+			report.MissingFields = append(report.MissingFields, spec.Name)
+			continue
+		}
+		expected[field.name] = true
+		if spec.Type != "" && spec.Type != string(rune(field.fieldType)) {
+			report.Mismatches = append(report.Mismatches, FieldMismatch{Field: spec.Name, Property: "type", Expected: spec.Type, Actual: string(rune(field.fieldType))})
+		}
+		if spec.Length != 0 && spec.Length != field.length {
+			report.Mismatches = append(report.Mismatches, FieldMismatch{Field: spec.Name, Property: "length", Expected: strconv.Itoa(int(spec.Length)), Actual: strconv.Itoa(int(field.length))})
+		}
+		if spec.Length != 0 && spec.DecimalPlaces != field.decimalPlaces {
+			report.Mismatches = append(report.Mismatches, FieldMismatch{Field: spec.Name, Property: "decimal_places", Expected: strconv.Itoa(int(spec.DecimalPlaces)), Actual: strconv.Itoa(int(field.decimalPlaces))})
+		}
+		c := check{field: field, spec: spec}
+		if spec.Pattern != "" {
+			pattern, err := regexp.Compile(spec.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			c.pattern = pattern
+		}
+		checks = append(checks, c)
+	}
+	if !schema.AllowExtraFields {
+		for _, f := range dbf.fieldsList {
+			if !expected[f.name] && !f.isSystem() {
+				report.ExtraFields = append(report.ExtraFields, f.name)
+			}
+		}
+	}
+	if !cfg.checkRecords {
+		return report, nil
+	}
+	for rec, err := range dbf.Records(SkipDeleted()) {
+		if err != nil {
+			return report, err
+		}
+		for _, c := range checks {
+			if cfg.maxRecordErrors > 0 && len(report.RecordErrors) >= cfg.maxRecordErrors {
+				report.Truncated = true
+				return report, nil
+			}
+			value, err := dbf.fieldString(rec.buff, c.field)
+			if decodeErr, ok := err.(*DecodeError); ok {
+				// 严格模式下不符合编码的内容也是记录错误
+				report.RecordErrors = append(report.RecordErrors, RecordError{RecordNo: rec.recordNo, Field: c.field.name, Value: string(decodeErr.Value), Err: ErrInvalidEncoding})
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+			if err = checkValue(dbf, c.field, c.spec, c.pattern, value); err != nil {
+				report.RecordErrors = append(report.RecordErrors, RecordError{RecordNo: rec.recordNo, Field: c.field.name, Value: value, Err: err})
+			}
+		}
+	}
+	return report, nil
+}
+
+// 检查一个值是否符合字段类型和规范，字段类型的检查和写入时的校验规则一致
+func checkValue(dbf *DBF, field dbfField, spec SchemaField, pattern *regexp.Regexp, value string) error {
+	// 全0的日期和空日期一样
+	if field.fieldType == fieldtype_date && strings.Trim(value, "0") == "" {
+		value = ""
+	}
+	if value == "" {
+		if spec.Required {
+			return ErrValueRequired
+		}
+		return nil
+	}
+	if !field.isBinary() && !field.isMemo() && !field.isRaw() {
+		if _, err := dbf.encodeText(field, value); err != nil {
+			return err
+		}
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return ErrPatternMismatch
+	}
+	return nil
+}
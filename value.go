@@ -0,0 +1,403 @@
+package godbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/shopspring/decimal"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 儒略日2440588是1970-01-01
+const julianDayOfUnixEpoch = 2440588
+const dateTimeFormat = "20060102150405"
+const dateTimeMillisFormat = "20060102150405.000"
+
+// 设置日期时间字段时支持的格式
+var dateTimeLayouts = []string{dateTimeFormat, "20060102", "2006-01-02 15:04:05", "2006-01-02", time.RFC3339}
+
+// 二进制存储的字段类型，不能当成字符串读写
+func (f dbfField) isBinary() bool {
+	switch f.fieldType {
+	case fieldtype_integer, fieldtype_double, fieldtype_currency, fieldtype_dateTime, fieldtype_timestamp, fieldtype_autoincrement, fieldtype_double7:
+		return true
+	}
+	return false
+}
+
+func fieldBytes(buff []byte, field dbfField) []byte {
+	return buff[field.displacement: field.displacement+uint32(field.length)]
+}
+
+// 日期时间字段的值，VFP的T字段和dBase 7的@字段格式不同
+func decodeDateTime(b []byte, field dbfField) time.Time {
+	if field.fieldType == fieldtype_timestamp {
+		return decodeTimestamp(b)
+	}
+	return decodeVFPDateTime(b)
+}
+
+func encodeDateTime(b []byte, field dbfField, t time.Time) {
+	if field.fieldType == fieldtype_timestamp {
+		encodeTimestamp(b, t)
+		return
+	}
+	encodeVFPDateTime(b, t)
+}
+
+// 双精度字段的值，VFP的B字段是小端，dBase 7的O字段可以按字节排序
+func decodeDouble(b []byte, field dbfField) float64 {
+	if field.fieldType == fieldtype_double7 {
+		return decodeDouble7(b)
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func decodeVFPDateTime(b []byte) time.Time {
+	day := binary.LittleEndian.Uint32(b[0:4])
+	if day == 0 || bytes.Equal(b, bytes.Repeat([]byte{space}, len(b))) {
+		return time.Time{}
+	}
+	ms := binary.LittleEndian.Uint32(b[4:8])
+	return time.Date(1970, 1, 1 + int(int64(day) - julianDayOfUnixEpoch), 0, 0, 0, int(ms) * int(time.Millisecond), time.Local)
+}
+
+func encodeVFPDateTime(b []byte, t time.Time) {
+	if t.IsZero() {
+		copy(b, make([]byte, len(b)))
+		return
+	}
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	ms := ((t.Hour() * 60 + t.Minute()) * 60 + t.Second()) * 1000 + t.Nanosecond() / int(time.Millisecond)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(days + julianDayOfUnixEpoch))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(ms))
+}
+
+func parseDateTime(value string) (t time.Time, err error) {
+	for _, layout := range dateTimeLayouts {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// 字段的文本值，二进制类型的字段转换成对应的文本
+func (dbf *DBF)fieldString(buff []byte, field dbfField) (string, error) {
+	// M和W字段里是备注块号，内容在备注文件里
+	if field.isMemo() {
+		return dbf.memoValue(buff, field)
+	}
+	b := fieldBytes(buff, field)
+	switch field.fieldType {
+	case fieldtype_integer, fieldtype_autoincrement:
+		if dbf.isDBase7() && isZero(b) {
+			return "", nil
+		}
+		return strconv.FormatInt(int64(dbf.decodeInt(b)), 10), nil
+	case fieldtype_double, fieldtype_double7:
+		if field.fieldType == fieldtype_double7 && isZero(b) {
+			return "", nil
+		}
+		precision := int(field.decimalPlaces)
+		if precision == 0 {
+			precision = -1
+		}
+		return strconv.FormatFloat(decodeDouble(b, field), 'f', precision, 64), nil
+	case fieldtype_currency:
+		return decimal.New(int64(binary.LittleEndian.Uint64(b)), -4).StringFixed(4), nil
+	case fieldtype_dateTime, fieldtype_timestamp:
+		t := decodeDateTime(b, field)
+		if t.IsZero() {
+			return "", nil
+		}
+		return formatDateTime(t), nil
+	case fieldtype_varchar, fieldtype_varbinary:
+		// 变长字段的内容就是实际的值，不去掉前后空格
+		b = dbf.varlengthBytes(buff, field)
+		if field.isRaw() || isASCII(b) {
+			return string(b), nil
+		}
+		return dbf.decode(b, field.name)
+	}
+	if field.isRaw() {
+		return strings.TrimSpace(string(b)), nil
+	}
+	// 纯ASCII的内容不需要转换编码，只复制一次
+	if isASCII(b) {
+		return strings.Clone(strings.TrimSpace(bytes2str(b))), nil
+	}
+	s, err := dbf.decode(b, field.name)
+	return strings.TrimSpace(s), err
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func (dbf *DBF)fieldInt(buff []byte, field dbfField) (int, error) {
+	b := fieldBytes(buff, field)
+	switch field.fieldType {
+	case fieldtype_integer, fieldtype_autoincrement:
+		return int(dbf.decodeInt(b)), nil
+	case fieldtype_double, fieldtype_double7:
+		return int(decodeDouble(b, field)), nil
+	case fieldtype_currency:
+		return int(decimal.New(int64(binary.LittleEndian.Uint64(b)), -4).IntPart()), nil
+	}
+	value, err := dbf.fieldString(buff, field)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func (dbf *DBF)fieldFloat(buff []byte, field dbfField) (float64, error) {
+	b := fieldBytes(buff, field)
+	switch field.fieldType {
+	case fieldtype_integer, fieldtype_autoincrement:
+		return float64(dbf.decodeInt(b)), nil
+	case fieldtype_double, fieldtype_double7:
+		return decodeDouble(b, field), nil
+	case fieldtype_currency:
+		value, _ := decimal.New(int64(binary.LittleEndian.Uint64(b)), -4).Float64()
+		return value, nil
+	}
+	value, err := dbf.fieldString(buff, field)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (dbf *DBF)fieldDecimal(buff []byte, field dbfField) (decimal.Decimal, error) {
+	b := fieldBytes(buff, field)
+	switch field.fieldType {
+	case fieldtype_integer, fieldtype_autoincrement:
+		return decimal.NewFromInt32(dbf.decodeInt(b)), nil
+	case fieldtype_double, fieldtype_double7:
+		return decimal.NewFromFloat(decodeDouble(b, field)), nil
+	case fieldtype_currency:
+		return decimal.New(int64(binary.LittleEndian.Uint64(b)), -4), nil
+	}
+	value, err := dbf.fieldString(buff, field)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromString(value)
+}
+
+// 把文本值编码成二进制字段的内容，空字符串写入0
+func (dbf *DBF)encodeBinary(b []byte, field dbfField, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		copy(b, make([]byte, len(b)))
+		return nil
+	}
+	switch field.fieldType {
+	case fieldtype_integer, fieldtype_autoincrement:
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return ErrValueOverflow
+			}
+			return ErrInvalidNumeric
+		}
+		dbf.encodeInt(b, int32(v))
+	case fieldtype_double, fieldtype_double7:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return ErrInvalidNumeric
+		}
+		if field.fieldType == fieldtype_double7 {
+			encodeDouble7(b, v)
+		} else {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+		}
+	case fieldtype_currency:
+		v, err := decimal.NewFromString(value)
+		if err != nil {
+			return ErrInvalidNumeric
+		}
+		v = v.Shift(4).Round(0)
+		if !v.BigInt().IsInt64() {
+			return ErrValueOverflow
+		}
+		binary.LittleEndian.PutUint64(b, uint64(v.IntPart()))
+	case fieldtype_dateTime, fieldtype_timestamp:
+		t, err := parseDateTime(value)
+		if err != nil {
+			return ErrInvalidDate
+		}
+		encodeDateTime(b, field, t)
+	}
+	return nil
+}
+
+const dateFormat = "20060102"
+
+// 日期字段的值，空日期返回零值
+func (dbf *DBF)fieldDate(buff []byte, field dbfField) (time.Time, error) {
+	if field.fieldType == fieldtype_dateTime || field.fieldType == fieldtype_timestamp {
+		return decodeDateTime(fieldBytes(buff, field), field), nil
+	}
+	value, err := dbf.fieldString(buff, field)
+	if err != nil || value == "" || strings.Trim(value, "0") == "" {
+		return time.Time{}, err
+	}
+	return parseDateTime(value)
+}
+
+// 逻辑字段的值，T/t/Y/y为真，F/f/N/n为假，?和空白表示未初始化，当成假
+func (dbf *DBF)fieldBool(buff []byte, field dbfField) (bool, error) {
+	value, err := dbf.fieldString(buff, field)
+	if err != nil || value == "" {
+		return false, err
+	}
+	switch value {
+	case "T", "t", "Y", "y":
+		return true, nil
+	case "F", "f", "N", "n", "?":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// 按字段类型把日期格式化成写入的文本，零值写入空日期
+func formatDate(field dbfField, t time.Time) string {
+	if t.IsZero() {
+		return strings.Repeat(" ", int(field.length))
+	}
+	if field.fieldType == fieldtype_dateTime || field.fieldType == fieldtype_timestamp {
+		return formatDateTime(t)
+	}
+	return t.Format(dateFormat)
+}
+
+// T和@字段都保存到毫秒，有毫秒的时候文本里带上毫秒，比如20210605143000.250，解析时time.Parse认识秒后面的小数
+func formatDateTime(t time.Time) string {
+	if t.Nanosecond() >= int(time.Millisecond) {
+		return t.Format(dateTimeMillisFormat)
+	}
+	return t.Format(dateTimeFormat)
+}
+
+func formatBool(field dbfField, b bool) string {
+	switch field.fieldType {
+	case fieldtype_logical, fieldtype_character:
+		if b {
+			return "T"
+		}
+		return "F"
+	}
+	if b {
+		return formatDecimal(field, decimal.NewFromInt(1))
+	}
+	return formatDecimal(field, decimal.Zero)
+}
+
+// 数值按字段的小数位数格式化，N/F字段右对齐
+func formatDecimal(field dbfField, d decimal.Decimal) string {
+	switch field.fieldType {
+	case fieldtype_numeric, fieldtype_float:
+		s := d.StringFixed(int32(field.decimalPlaces))
+		if len(s) < int(field.length) {
+			s = strings.Repeat(" ", int(field.length) - len(s)) + s
+		}
+		return s
+	case fieldtype_currency:
+		return d.StringFixed(4)
+	}
+	return d.String()
+}
+
+// 把文本值按字段类型校验并格式化成字段长度的内容，C左对齐，N/F右对齐并按小数位数四舍五入
+func (dbf *DBF)encodeText(field dbfField, value string) ([]byte, error) {
+	text := strings.TrimSpace(value)
+	switch field.fieldType {
+	case fieldtype_numeric, fieldtype_float:
+		if text != "" {
+			d, err := decimal.NewFromString(text)
+			if err != nil {
+				return nil, ErrInvalidNumeric
+			}
+			text = d.StringFixed(int32(field.decimalPlaces))
+		}
+		return dbf.justify(field, text, true)
+	case fieldtype_date:
+		if text != "" {
+			t, err := parseDateTime(text)
+			if err != nil {
+				return nil, ErrInvalidDate
+			}
+			text = t.Format(dateFormat)
+		}
+	case fieldtype_logical:
+		switch text {
+		case "T", "t", "Y", "y", "1", "true", "TRUE", "True":
+			text = "T"
+		case "F", "f", "N", "n", "0", "false", "FALSE", "False":
+			text = "F"
+		case "", "?":
+		default:
+			return nil, ErrInvalidLogical
+		}
+	default:
+		if field.isRaw() {
+			// 不做编码转换，超长时按字节截断
+			return dbf.justify(field, value, false)
+		}
+		encoded, err := dbf.encode(value)
+		if err != nil {
+			return nil, err
+		}
+		text = encoded
+		if len(text) > int(field.length) && dbf.overflow == OverflowTruncate {
+			// 按字符截断，避免留下半个多字节字符，严格模式下返回截断后的内容和ErrValueTruncated
+			text = dbf.truncateText(value, int(field.length))
+			b, _ := dbf.justify(field, text, false)
+			if dbf.strictEncoding {
+				return b, ErrValueTruncated
+			}
+			return b, nil
+		}
+	}
+	return dbf.justify(field, text, false)
+}
+
+// 编码之后不超过limit字节的最长前缀
+func (dbf *DBF)truncateText(value string, limit int) string {
+	var b strings.Builder
+	for _, r := range value {
+		encoded, err := dbf.encode(string(r))
+		if err != nil || b.Len() + len(encoded) > limit {
+			break
+		}
+		b.WriteString(encoded)
+	}
+	return b.String()
+}
+
+func (dbf *DBF)justify(field dbfField, text string, right bool) ([]byte, error) {
+	b := bytes.Repeat([]byte{space}, int(field.length))
+	if len(text) > len(b) {
+		if dbf.overflow != OverflowTruncate {
+			return nil, ErrValueOverflow
+		}
+		text = text[:len(b)]
+	}
+	if right {
+		copy(b[len(b) - len(text):], text)
+	} else {
+		copy(b, text)
+	}
+	return b, nil
+}
@@ -0,0 +1,136 @@
+package godbf
+
+/*
+	VFP9的变长字段说明：
+	V(varchar)和Q(varbinary)在记录里占固定的长度，内容比字段短时，_NullFlags里对应的变长位为1，字段最后一位是实际长度，
+	内容和字段一样长时变长位为0，整个字段都是内容。每个变长字段先占一个变长位，可以为NULL时再占一个NULL位
+	W(blob)和备注字段一样，记录里是4位的块号，内容保存在.FPT文件里
+	Q、W以及标志包含0x04的字段不做编码转换
+*/
+
+func (f dbfField) isVarlength() bool {
+	return f.fieldType == fieldtype_varchar || f.fieldType == fieldtype_varbinary
+}
+
+// 字段内容不做编码转换，原样读写
+func (f dbfField) isRaw() bool {
+	switch f.fieldType {
+	case fieldtype_varbinary, fieldtype_blob:
+		return true
+	case fieldtype_character, fieldtype_memo, fieldtype_varchar:
+		return f.flag & fieldflag_binary != 0
+	}
+	return false
+}
+
+// 变长字段的实际内容
+func (dbf *DBF)varlengthBytes(buff []byte, field dbfField) []byte {
+	b := fieldBytes(buff, field)
+	if !dbf.isNullFlagSet(buff, field.varlengthBit) {
+		return b
+	}
+	n := int(b[len(b) - 1])
+	if n > len(b) - 1 {
+		n = len(b) - 1
+	}
+	return b[:n]
+}
+
+// 写入变长字段的内容，比字段短时剩余部分补0，最后一位写实际长度
+func (dbf *DBF)putVarlength(field dbfField, data []byte) {
+	b := fieldBytes(dbf.recordBuff, field)
+	copy(b, data)
+	if len(data) >= len(b) {
+		dbf.setNullFlag(field.varlengthBit, false)
+		return
+	}
+	copy(b[len(data):], make([]byte, len(b) - len(data)))
+	b[len(b) - 1] = byte(len(data))
+	dbf.setNullFlag(field.varlengthBit, true)
+}
+
+// 变长字段按编码转换之后的内容写入，超长时按OverflowPolicy处理
+func (dbf *DBF)setVarlength(field dbfField, value string) error {
+	data := value
+	if !field.isRaw() {
+		encoded, err := dbf.encode(value)
+		if err != nil {
+			return err
+		}
+		data = encoded
+	}
+	var err error
+	if len(data) > int(field.length) {
+		if dbf.overflow != OverflowTruncate {
+			return ErrValueOverflow
+		}
+		if field.isRaw() {
+			data = data[:field.length]
+		} else {
+			data = dbf.truncateText(value, int(field.length))
+		}
+		if dbf.strictEncoding {
+			err = ErrValueTruncated
+		}
+	}
+	dbf.putVarlength(field, str2bytes(data))
+	return err
+}
+
+// 字段不做编码转换的原始内容，变长字段只包括实际长度的部分
+func (dbf *DBF)fieldBytesValue(buff []byte, field dbfField) ([]byte, error) {
+	if dbf.isNull(buff, field) {
+		return nil, nil
+	}
+	var b []byte
+	switch {
+	case field.isMemo():
+		if dbf.memo == nil {
+			return nil, memo_file_not_exists
+		}
+		return dbf.memo.read(memoBlock(fieldBytes(buff, field)))
+	case field.isVarlength():
+		b = dbf.varlengthBytes(buff, field)
+	default:
+		b = fieldBytes(buff, field)
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// BytesValueByName 当前记录字段的原始内容，不做编码转换，适合Q、W和二进制字段，NULL时返回nil
+func (dbf *DBF)BytesValueByName(fieldname string) ([]byte, error) {
+	field, ok := dbf.lookupField(fieldname)
+	if !ok {
+		return nil, field_not_exists
+	}
+	return dbf.fieldBytesValue(dbf.recordBuff, field)
+}
+
+func (r *Record)BytesValueByName(fieldname string) ([]byte, error) {
+	field, ok := r.dbf.lookupField(fieldname)
+	if !ok {
+		return nil, field_not_exists
+	}
+	return r.dbf.fieldBytesValue(r.buff, field)
+}
+
+// AddVarcharField 添加VFP9的变长字符字段，文件会改成VFP格式
+func (dbf *DBF)AddVarcharField(fieldName string, length uint8) {
+	dbf.addField(fieldName, fieldtype_varchar, length, 0)
+	dbf.useVisualFoxPro()
+}
+
+// AddVarbinaryField 添加VFP9的变长二进制字段，内容不做编码转换，文件会改成VFP格式
+func (dbf *DBF)AddVarbinaryField(fieldName string, length uint8) {
+	if dbf.addField(fieldName, fieldtype_varbinary, length, 0) != nil {
+		return
+	}
+	dbf.setFieldFlag(fieldName, fieldflag_binary)
+	dbf.useVisualFoxPro()
+}
+
+// AddBlobField 添加VFP9的二进制大对象字段，和备注字段一样保存在.FPT文件里，内容不做编码转换，文件会改成VFP格式
+func (dbf *DBF)AddBlobField(fieldName string) {
+	dbf.addField(fieldName, fieldtype_blob, 4, 0)
+	dbf.useVisualFoxPro()
+}
@@ -0,0 +1,202 @@
+package godbf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"io"
+	"time"
+)
+
+// Writer 只能往前写的DBF生成器，适合直接写到HTTP响应或者zip包里，不支持备注和blob字段
+//
+//	w, err := godbf.NewWriter(resp, fields, "gbk")
+//	for _, q := range quotes {
+//		w.Append()
+//		w.SetFieldValue("STOCK_CODE", q.Code)
+//		if err = w.Post(); err != nil {
+//			return err
+//		}
+//	}
+//	return w.Close()
+//
+// w实现了io.WriteSeeker时，文件头先写出去，Close的时候回到文件头改写记录数和自增字段；
+// 否则记录先缓存在内存里，Close的时候连同文件头一起写出去，占用的内存和整个文件一样大。
+// 写到HTTP响应、zip包这种不能seek的地方时，可以用WithRecordCount预先声明记录数，文件头先写出去，记录直接写到w里。
+type Writer struct {
+	dbf *DBF
+	w io.Writer
+	seeker io.WriteSeeker  //w不能seek时为nil
+	start int64  //文件头在w里的位置
+	out *bufio.Writer
+	pending bytes.Buffer  //w不能seek时缓存的记录
+	count uint32
+	closed bool
+}
+
+// NewWriter 按字段描述创建Writer，字段的添加规则和AddField一样，Close不会关闭w
+func NewWriter(w io.Writer, fields []Field, encoding string, opts ...Option) (*Writer, error) {
+	dbf, err := NewFile("", encoding, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		// 备注和blob字段的内容要写到单独的备注文件里，Writer只输出一个DBF
+		if t := fieldType(f.Type); t == fieldtype_memo || t == fieldtype_blob {
+			return nil, memo_not_supported
+		}
+		if err = dbf.AddField(f); err != nil {
+			return nil, err
+		}
+	}
+	if dbf.fieldsCount <= 0 {
+		return nil, empty_fields
+	}
+	dbf.Append()
+	writer := &Writer{dbf: dbf, w: w}
+	if seeker, ok := w.(io.WriteSeeker); ok {
+		// 管道之类的文件虽然实现了Seek，但是调用会失败，这种情况按不能seek处理
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			writer.seeker = seeker
+			writer.start = start
+		}
+	}
+	if writer.seeker == nil && dbf.recordCountHint == nil {
+		writer.out = bufio.NewWriter(&writer.pending)
+		return writer, nil
+	}
+	writer.out = bufio.NewWriter(w)
+	header := dbf.headerBytes()
+	if writer.seeker == nil {
+		header = writer.declaredHeader(*dbf.recordCountHint)
+	}
+	if _, err = writer.out.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// 预先声明了记录数时的文件头，自增字段的下一个值按记录数推算出来
+func (w *Writer)declaredHeader(count uint32) []byte {
+	dbf := w.dbf
+	fields := append([]dbfField(nil), dbf.fieldsList...)
+	for i := range dbf.fieldsList {
+		if field := &dbf.fieldsList[i]; field.isAutoincrement() {
+			field.autoincrementNext += count * uint32(field.autoincrementStep)
+		}
+	}
+	dbf.head.recordCount = count
+	header := dbf.headerBytes()
+	dbf.head.recordCount = 0
+	dbf.fieldsList = fields
+	return header
+}
+
+// 预先声明了记录数，文件头已经写出去，不能seek回去修改
+func (w *Writer)streaming() bool {
+	return w.seeker == nil && w.dbf.recordCountHint != nil
+}
+
+// Fields 按文件里的顺序返回所有字段的描述
+func (w *Writer)Fields() []Field {
+	return w.dbf.Fields()
+}
+
+// RecordCount 已经提交的记录数
+func (w *Writer)RecordCount() uint32 {
+	return w.count
+}
+
+// Append 开始一条新记录，NewWriter和Post之后会自动开始新记录，可以不调用
+func (w *Writer)Append() {
+	w.dbf.Append()
+}
+
+func (w *Writer)SetFieldValue(fieldname string, value string) error {
+	return w.dbf.SetFieldValue(fieldname, value)
+}
+
+func (w *Writer)SetDateValue(fieldname string, value time.Time) error {
+	return w.dbf.SetDateValue(fieldname, value)
+}
+
+func (w *Writer)SetBoolValue(fieldname string, value bool) error {
+	return w.dbf.SetBoolValue(fieldname, value)
+}
+
+func (w *Writer)SetIntValue(fieldname string, value int) error {
+	return w.dbf.SetIntValue(fieldname, value)
+}
+
+func (w *Writer)SetDecimalValue(fieldname string, value decimal.Decimal) error {
+	return w.dbf.SetDecimalValue(fieldname, value)
+}
+
+// SetNull 把可以为NULL的字段设置成NULL
+func (w *Writer)SetNull(fieldname string) error {
+	return w.dbf.SetNull(fieldname)
+}
+
+// AppendStruct 按dbf标签把结构体的值写成一条新记录并提交
+func (w *Writer)AppendStruct(src any) error {
+	if err := w.dbf.appendStruct(src); err != nil {
+		return err
+	}
+	return w.Post()
+}
+
+// Post 提交当前记录，然后开始一条新记录
+func (w *Writer)Post() error {
+	if w.closed {
+		return writer_closed
+	}
+	if w.streaming() && w.count >= *w.dbf.recordCountHint {
+		return fmt.Errorf("%w: declared %d records", record_count_mismatch, *w.dbf.recordCountHint)
+	}
+	w.dbf.assignAutoincrement()
+	if _, err := w.out.Write(w.dbf.recordBuff); err != nil {
+		return err
+	}
+	w.count++
+	w.dbf.Append()
+	return nil
+}
+
+// Close 写文件结束标记并更新文件头的记录数，不会关闭底层的io.Writer
+func (w *Writer)Close() error {
+	if w.closed {
+		return writer_closed
+	}
+	w.closed = true
+	if err := w.out.WriteByte(fileTerminator); err != nil {
+		return err
+	}
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+	if w.streaming() {
+		if w.count != *w.dbf.recordCountHint {
+			return fmt.Errorf("%w: declared %d records, wrote %d", record_count_mismatch, *w.dbf.recordCountHint, w.count)
+		}
+		return nil
+	}
+	w.dbf.head.recordCount = w.count
+	if w.seeker == nil {
+		if _, err := w.w.Write(w.dbf.headerBytes()); err != nil {
+			return err
+		}
+		_, err := w.pending.WriteTo(w.w)
+		return err
+	}
+	// 回到文件头改写记录数和自增字段的下一个值，然后回到文件尾，方便调用方继续往后写
+	end := w.start + int64(w.dbf.head.dataOffset) + int64(w.count) * int64(w.dbf.head.recordSize) + 1
+	if _, err := w.seeker.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.seeker.Write(w.dbf.headerBytes()); err != nil {
+		return err
+	}
+	_, err := w.seeker.Seek(end, io.SeekStart)
+	return err
+}